@@ -20,11 +20,20 @@ under the License.
 package main
 
 import (
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
 // ============================================================================================================================
@@ -63,6 +72,795 @@ func get_owner(stub shim.ChaincodeStubInterface, id string) (Owner, error) {
 	return owner, nil
 }
 
+// ============================================================================================================================
+// Put Marble - store the marble asset with its id as key
+// ============================================================================================================================
+func put_marble(stub shim.ChaincodeStubInterface, marble Marble) error {
+	marbleAsBytes, _ := json.Marshal(marble)                   //convert to array of bytes
+	return stub.PutState(marble.Id, marbleAsBytes)             //rewrite the marble with id as key
+}
+
+// ============================================================================================================================
+// Operator Key - composite key of an owner's operator, operator~owner~operator
+// ============================================================================================================================
+func operator_key(stub shim.ChaincodeStubInterface, owner_id string, operator_id string) (string, error) {
+	return stub.CreateCompositeKey("operator", []string{owner_id, operator_id})
+}
+
+// ============================================================================================================================
+// Is Approved For All - test if an owner made another owner an operator of all their marbles
+// ============================================================================================================================
+func is_approved_for_all(stub shim.ChaincodeStubInterface, owner_id string, operator_id string) (bool, error) {
+	key, err := operator_key(stub, owner_id, operator_id)
+	if err != nil {
+		return false, err
+	}
+	valAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return false, errors.New("Failed to get operator - " + operator_id)
+	}
+	return valAsBytes != nil, nil
+}
+
+// ============================================================================================================================
+// Get Creator - get the serialized identity (msp id + cert) that submitted this transaction
+// ============================================================================================================================
+func get_creator(stub shim.ChaincodeStubInterface) (msp.SerializedIdentity, error) {
+	var identity msp.SerializedIdentity
+	creatorAsBytes, err := stub.GetCreator()
+	if err != nil {
+		return identity, errors.New("Failed to get transaction creator")
+	}
+
+	err = proto.Unmarshal(creatorAsBytes, &identity)
+	if err != nil {
+		return identity, errors.New("Failed to parse transaction creator")
+	}
+	return identity, nil
+}
+
+// ============================================================================================================================
+// Get Creator Cert - get the enrollment cert of the identity that submitted this transaction
+// ============================================================================================================================
+func get_creator_cert(stub shim.ChaincodeStubInterface) (*x509.Certificate, error) {
+	identity, err := get_creator(stub)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return nil, errors.New("Failed to decode creator cert")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Failed to parse creator cert")
+	}
+	return cert, nil
+}
+
+// ============================================================================================================================
+// Get Creator Id - get "<msp id>/<enrollment id>" of the identity that submitted this transaction
+// ============================================================================================================================
+func get_creator_id(stub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := get_creator(stub)
+	if err != nil {
+		return "", err
+	}
+	cert, err := get_creator_cert(stub)
+	if err != nil {
+		return "", err
+	}
+	return identity.Mspid + "/" + cert.Subject.CommonName, nil
+}
+
+// ============================================================================================================================
+// Check Owner Identity - make sure the caller is the identity the owner is bound to
+// ============================================================================================================================
+func check_owner_identity(stub shim.ChaincodeStubInterface, owner Owner) error {
+	if owner.Identity == "" {
+		return errors.New("Owner '" + owner.Id + "' is not bound to an identity")
+	}
+	creator_id, err := get_creator_id(stub)
+	if err != nil {
+		return err
+	}
+	if creator_id != owner.Identity {
+		return errors.New("The identity '" + creator_id + "' cannot act for owner '" + owner.Id + "'.")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Creator Attribute - get an attribute the CA put in the creator's enrollment cert, "" if it isn't there
+// ============================================================================================================================
+func get_creator_attribute(stub shim.ChaincodeStubInterface, name string) (string, error) {
+	type Attributes struct {
+		Attrs map[string]string `json:"attrs"`
+	}
+	var attrs Attributes
+	attrOID := asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}   //extension fabric-ca stores attributes in
+
+	cert, err := get_creator_cert(stub)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(attrOID) {
+			json.Unmarshal(ext.Value, &attrs)                  //un stringify it aka JSON.parse()
+			return attrs.Attrs[name], nil
+		}
+	}
+	return "", nil
+}
+
+// ============================================================================================================================
+// Check Role - make sure the caller's cert carries the attribute marbles.role=<role>
+// ============================================================================================================================
+func check_role(stub shim.ChaincodeStubInterface, role string) error {
+	creator_role, err := get_creator_attribute(stub, "marbles.role")
+	if err != nil {
+		return err
+	}
+	if creator_role != role {
+		return errors.New("Caller does not have the marbles role '" + role + "'")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Balance - get an owner's marble coin balance, 0 if they never held any
+// ============================================================================================================================
+func get_balance(stub shim.ChaincodeStubInterface, owner_id string) (int64, error) {
+	key, err := stub.CreateCompositeKey("balance", []string{owner_id})
+	if err != nil {
+		return 0, err
+	}
+	balanceAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return 0, errors.New("Failed to get balance - " + owner_id)
+	}
+	if balanceAsBytes == nil {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(balanceAsBytes), 10, 64)
+}
+
+// ============================================================================================================================
+// Put Balance - store an owner's marble coin balance
+// ============================================================================================================================
+func put_balance(stub shim.ChaincodeStubInterface, owner_id string, balance int64) error {
+	key, err := stub.CreateCompositeKey("balance", []string{owner_id})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte(strconv.FormatInt(balance, 10)))
+}
+
+// ============================================================================================================================
+// Move Coins - debit one owner and credit another, error if the sender can't cover it
+// ============================================================================================================================
+func move_coins(stub shim.ChaincodeStubInterface, from_id string, to_id string, amount int64) error {
+	from_balance, err := get_balance(stub, from_id)
+	if err != nil {
+		return err
+	}
+	if from_balance < amount {
+		return errors.New("Insufficient balance - " + from_id + " has " + strconv.FormatInt(from_balance, 10))
+	}
+	err = put_balance(stub, from_id, from_balance - amount)
+	if err != nil {
+		return err
+	}
+
+	to_balance, err := get_balance(stub, to_id)                //read after the debit, from and to may be the same
+	if err != nil {
+		return err
+	}
+	return put_balance(stub, to_id, to_balance + amount)
+}
+
+// ============================================================================================================================
+// Parse Amount - parse a positive amount of marble coins
+// ============================================================================================================================
+func parse_amount(str string) (int64, error) {
+	amount, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, errors.New("Amount must be a positive numeric string")
+	}
+	return amount, nil
+}
+
+// ============================================================================================================================
+// Get Listing - get a marble's marketplace listing
+// ============================================================================================================================
+func get_listing(stub shim.ChaincodeStubInterface, marble_id string) (Listing, error) {
+	var listing Listing
+	key, err := stub.CreateCompositeKey("listing", []string{marble_id})
+	if err != nil {
+		return listing, err
+	}
+	listingAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return listing, errors.New("Failed to get listing - " + marble_id)
+	}
+	json.Unmarshal(listingAsBytes, &listing)                   //un stringify it aka JSON.parse()
+
+	if listing.MarbleId != marble_id {                         //test if listing is actually here or just nil
+		return listing, errors.New("Marble is not listed - " + marble_id)
+	}
+	return listing, nil
+}
+
+// ============================================================================================================================
+// Remove Listing - take a marble off the marketplace, fine if it wasn't listed
+// ============================================================================================================================
+func remove_listing(stub shim.ChaincodeStubInterface, marble_id string) error {
+	key, err := stub.CreateCompositeKey("listing", []string{marble_id})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+// ============================================================================================================================
+// Total Shares - total units in a co-owned marble's cap table
+// ============================================================================================================================
+func total_shares(marble Marble) int {
+	total := 0
+	for _, units := range marble.Shares {
+		total += units
+	}
+	return total
+}
+
+// ============================================================================================================================
+// Consent Key - composite key of a holder's consent, consent~marble~holder
+// ============================================================================================================================
+func consent_key(stub shim.ChaincodeStubInterface, marble_id string, holder_id string) (string, error) {
+	return stub.CreateCompositeKey("consent", []string{marble_id, holder_id})
+}
+
+// ============================================================================================================================
+// Check Share Quorum - error unless holders of the marble's quorum of units consented to this action, nil if not co-owned
+// ============================================================================================================================
+func check_share_quorum(stub shim.ChaincodeStubInterface, marble Marble, action string, target string) error {
+	if marble.Shares == nil {
+		return nil
+	}
+
+	consented := 0
+	for holder_id, units := range marble.Shares {
+		key, err := consent_key(stub, marble.Id, holder_id)
+		if err != nil {
+			return err
+		}
+		consentAsBytes, err := stub.GetState(key)
+		if err != nil {
+			return errors.New("Failed to get consent - " + holder_id)
+		}
+		var consent Consent
+		json.Unmarshal(consentAsBytes, &consent)               //un stringify it aka JSON.parse()
+		if consent.Action == action && consent.Target == target {
+			consented += units
+		}
+	}
+
+	total := total_shares(marble)
+	if consented * 100 < marble.Quorum * total {
+		return errors.New("Marble '" + marble.Id + "' needs consent from " + strconv.Itoa(marble.Quorum) + "% of shares, has " + strconv.Itoa(consented) + " of " + strconv.Itoa(total) + " units")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Clear Consents - remove all consents given for a marble, they were for a cap table that no longer exists
+// ============================================================================================================================
+func clear_consents(stub shim.ChaincodeStubInterface, marble_id string) error {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("consent", []string{marble_id})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		key, _, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Error Response - an error with a status code other than shim.Error()'s 500
+// ============================================================================================================================
+func error_response(status int32, message string) pb.Response {
+	return pb.Response{Status: status, Message: message}
+}
+
+// FrozenError is returned for marbles and owners under a compliance freeze, see transfer_error()
+type FrozenError struct {
+	Freeze Freeze
+}
+
+func (e FrozenError) Error() string {
+	return "The " + e.Freeze.Kind + " '" + e.Freeze.TargetId + "' is frozen under case '" + e.Freeze.CaseRef + "'"
+}
+
+// ============================================================================================================================
+// Transfer Error - the response for an error from assert_transferable(), frozen assets get status LOCKED
+// ============================================================================================================================
+func transfer_error(err error) pb.Response {
+	if _, ok := err.(FrozenError); ok {
+		return error_response(LOCKED, err.Error())
+	}
+	return shim.Error(err.Error())
+}
+
+// ============================================================================================================================
+// Get Freeze - get the freeze on a marble or owner, nil if it isn't frozen
+// ============================================================================================================================
+func get_freeze(stub shim.ChaincodeStubInterface, kind string, id string) (*Freeze, error) {
+	key, err := stub.CreateCompositeKey("freeze", []string{kind, id})
+	if err != nil {
+		return nil, err
+	}
+	freezeAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get freeze - " + id)
+	}
+	if freezeAsBytes == nil {
+		return nil, nil
+	}
+	var freeze Freeze
+	json.Unmarshal(freezeAsBytes, &freeze)                     //un stringify it aka JSON.parse()
+	return &freeze, nil
+}
+
+// ============================================================================================================================
+// Assert Owner Not Frozen - FrozenError if everything the owner holds is frozen
+// ============================================================================================================================
+func assert_owner_not_frozen(stub shim.ChaincodeStubInterface, owner_id string) error {
+	freeze, err := get_freeze(stub, "owner", owner_id)
+	if err != nil {
+		return err
+	}
+	if freeze != nil {
+		return FrozenError{*freeze}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Loss Report - get the lost/stolen report on a marble, nil if it isn't flagged
+// ============================================================================================================================
+func get_loss_report(stub shim.ChaincodeStubInterface, marble_id string) (*LossReport, error) {
+	key, err := stub.CreateCompositeKey("loss_report", []string{marble_id})
+	if err != nil {
+		return nil, err
+	}
+	reportAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get loss report - " + marble_id)
+	}
+	if reportAsBytes == nil {
+		return nil, nil
+	}
+	var report LossReport
+	json.Unmarshal(reportAsBytes, &report)                     //un stringify it aka JSON.parse()
+	return &report, nil
+}
+
+// ============================================================================================================================
+// Was Owner - test if an owner ever owned the marble, from the marble's history
+// ============================================================================================================================
+func was_owner(stub shim.ChaincodeStubInterface, marble_id string, owner_id string) (bool, error) {
+	resultsIterator, err := stub.GetHistoryForKey(marble_id)
+	if err != nil {
+		return false, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, historicValue, err := resultsIterator.Next()
+		if err != nil {
+			return false, err
+		}
+		var marble Marble
+		json.Unmarshal(historicValue, &marble)                 //un stringify it aka JSON.parse()
+		if marble.Owner.Id == owner_id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ============================================================================================================================
+// Assert Not Frozen - FrozenError if the marble, its owner or one of its co-owners is frozen
+// ============================================================================================================================
+func assert_not_frozen(stub shim.ChaincodeStubInterface, marble Marble) error {
+	freeze, err := get_freeze(stub, "marble", marble.Id)
+	if err != nil {
+		return err
+	}
+	if freeze != nil {
+		return FrozenError{*freeze}
+	}
+	err = assert_owner_not_frozen(stub, marble.Owner.Id)
+	if err != nil {
+		return err
+	}
+	for holder_id := range marble.Shares {                     //a frozen co-owner freezes the marble too
+		err = assert_owner_not_frozen(stub, holder_id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Assert Transferable - error if the marble can't currently change owners or be deleted
+// ============================================================================================================================
+func assert_transferable(stub shim.ChaincodeStubInterface, marble Marble) error {
+	err := assert_not_frozen(stub, marble)
+	if err != nil {
+		return err
+	}
+
+	report, err := get_loss_report(stub, marble.Id)
+	if err != nil {
+		return err
+	}
+	if report != nil {
+		return errors.New("Marble '" + marble.Id + "' is reported " + report.Status + ", it must be recovered first")
+	}
+
+	if marble.Custodian != nil {
+		return errors.New("Marble '" + marble.Id + "' is leased to '" + marble.Custodian.Id + "', it must be returned first")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Transfer Marble - change the owner of a marble, clearing its single marble approval, any listing and any cap table
+// ============================================================================================================================
+func transfer_marble(stub shim.ChaincodeStubInterface, marble Marble, owner Owner) error {
+	marble.Owner.Id = owner.Id                                 //change the owner
+	marble.Owner.Username = owner.Username
+	marble.Owner.Company = owner.Company
+	marble.Approved = ""                                       //the approval was the old owner's to give
+	err := remove_listing(stub, marble.Id)                     //so was the listing
+	if err != nil {
+		return err
+	}
+	if marble.Shares != nil {                                  //the new owner owns all of it
+		marble.Shares = nil
+		marble.Quorum = 0
+		err = clear_consents(stub, marble.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return put_marble(stub, marble)
+}
+
+// ============================================================================================================================
+// Get Tx Time - get the transaction's timestamp in unix seconds, the same on every endorsing peer
+// ============================================================================================================================
+func get_tx_time(stub shim.ChaincodeStubInterface) (int64, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return 0, errors.New("Failed to get transaction timestamp")
+	}
+	return timestamp.Seconds, nil
+}
+
+// ============================================================================================================================
+// Get Company Signers - get a company's designated signers, an error if the company has none
+// ============================================================================================================================
+func get_company_signers(stub shim.ChaincodeStubInterface, company string) (CompanySigners, error) {
+	var signers CompanySigners
+	key, err := stub.CreateCompositeKey("company_signers", []string{company})
+	if err != nil {
+		return signers, err
+	}
+	signersAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return signers, errors.New("Failed to get signers - " + company)
+	}
+	json.Unmarshal(signersAsBytes, &signers)                   //un stringify it aka JSON.parse()
+
+	if signers.Threshold <= 0 {                                //test if signers are actually here or just nil
+		return signers, errors.New("Company has no designated signers - " + company)
+	}
+	return signers, nil
+}
+
+// ============================================================================================================================
+// Get Pending Transfer - get a multi-sig transfer request from ledger
+// ============================================================================================================================
+func get_pending_transfer(stub shim.ChaincodeStubInterface, id string) (PendingTransfer, error) {
+	var transfer PendingTransfer
+	transferAsBytes, err := stub.GetState(id)
+	if err != nil {
+		return transfer, errors.New("Failed to find transfer - " + id)
+	}
+	json.Unmarshal(transferAsBytes, &transfer)                 //un stringify it aka JSON.parse()
+
+	if transfer.Id != id || transfer.ObjectType != "pending_transfer" {
+		return transfer, errors.New("Transfer does not exist - " + id)
+	}
+	return transfer, nil
+}
+
+// ============================================================================================================================
+// Count Signatures - count the signatures made by signers that are still designated
+// ============================================================================================================================
+func count_signatures(transfer PendingTransfer, signers CompanySigners) int {
+	count := 0
+	for _, signature := range transfer.Signatures {
+		if contains(signers.Signers, signature) {
+			count++
+		}
+	}
+	return count
+}
+
+// ============================================================================================================================
+// Contains - test if a string is in a slice
+// ============================================================================================================================
+func contains(list []string, str string) bool {
+	for _, val := range list {
+		if val == str {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// Default Attribute Schema - the schema used for a docType until an admin stores one, see set_attribute_schema()
+//
+// Nothing is required so marbles created with only color and size keep working
+// ============================================================================================================================
+func default_attribute_schema(doc_type string) AttributeSchema {
+	var schema AttributeSchema
+	schema.ObjectType = "attribute_schema"
+	schema.ForDocType = doc_type
+	schema.Attributes = map[string]AttributeRule{}
+	if doc_type == "marble" {
+		schema.Attributes["material"] = AttributeRule{Type: "string", Enum: []string{"glass", "clay", "agate", "steel", "porcelain"}}
+		schema.Attributes["pattern"] = AttributeRule{Type: "string", Enum: []string{"solid", "swirl", "cats_eye", "onionskin", "clearie"}}
+		schema.Attributes["rarity"] = AttributeRule{Type: "string", Enum: []string{"common", "uncommon", "rare", "legendary"}, Mutable: true}
+		schema.Attributes["manufacture_date"] = AttributeRule{Type: "date"}
+		schema.Attributes["serial"] = AttributeRule{Type: "string"}
+		schema.Attributes["image_hash"] = AttributeRule{Type: "hash", Mutable: true}
+	}
+	return schema
+}
+
+// ============================================================================================================================
+// Get Attribute Schema - get the attribute schema stored for a docType, the default schema if none was stored
+// ============================================================================================================================
+func get_attribute_schema(stub shim.ChaincodeStubInterface, doc_type string) (AttributeSchema, error) {
+	var schema AttributeSchema
+	key, err := stub.CreateCompositeKey("attribute_schema", []string{doc_type})
+	if err != nil {
+		return schema, err
+	}
+	schemaAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return schema, errors.New("Failed to get attribute schema - " + doc_type)
+	}
+	if schemaAsBytes == nil {
+		return default_attribute_schema(doc_type), nil
+	}
+	json.Unmarshal(schemaAsBytes, &schema)                     //un stringify it aka JSON.parse()
+	return schema, nil
+}
+
+// ============================================================================================================================
+// Parse Attribute Args - turn "name=value" arguments into a map, a value may be empty
+// ============================================================================================================================
+func parse_attribute_args(args []string) (map[string]string, error) {
+	attributes := map[string]string{}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, errors.New("Attribute '" + arg + "' must be of the form name=value")
+		}
+		if len(arg) > 128 {
+			return nil, errors.New("Attribute '" + parts[0] + "' must be <= 128 characters")
+		}
+		if _, ok := attributes[parts[0]]; ok {
+			return nil, errors.New("Attribute '" + parts[0] + "' is given more than once")
+		}
+		attributes[parts[0]] = parts[1]
+	}
+	return attributes, nil
+}
+
+var hashPattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// ============================================================================================================================
+// Validate Attribute - error if the value doesn't match the attribute's rule
+// ============================================================================================================================
+func validate_attribute(name string, rule AttributeRule, value string) error {
+	switch rule.Type {
+	case "string":
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return errors.New("Attribute '" + name + "' must be a numeric string")
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return errors.New("Attribute '" + name + "' must be a date as yyyy-mm-dd")
+		}
+	case "hash":
+		if !hashPattern.MatchString(value) {
+			return errors.New("Attribute '" + name + "' must be a lowercase hex sha256")
+		}
+	default:
+		return errors.New("Attribute '" + name + "' has unknown type '" + rule.Type + "'")
+	}
+
+	if len(rule.Enum) > 0 && !contains(rule.Enum, value) {
+		return errors.New("Attribute '" + name + "' must be one of " + strings.Join(rule.Enum, ", "))
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Validate Attributes - error if the attributes break the schema, unknown names and missing required ones included
+// ============================================================================================================================
+func validate_attributes(schema AttributeSchema, attributes map[string]string) error {
+	for name, value := range attributes {
+		rule, ok := schema.Attributes[name]
+		if !ok {
+			return errors.New("Attribute '" + name + "' is not in the " + schema.ForDocType + " schema")
+		}
+		err := validate_attribute(name, rule, value)
+		if err != nil {
+			return err
+		}
+	}
+	for name, rule := range schema.Attributes {
+		if _, ok := attributes[name]; rule.Required && !ok {
+			return errors.New("Attribute '" + name + "' is required")
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Certification - get a marble's certification
+// ============================================================================================================================
+func get_certification(stub shim.ChaincodeStubInterface, marble_id string, id string) (Certification, error) {
+	var certification Certification
+	key, err := stub.CreateCompositeKey("certification", []string{marble_id, id})
+	if err != nil {
+		return certification, err
+	}
+	certificationAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return certification, errors.New("Failed to get certification - " + id)
+	}
+	json.Unmarshal(certificationAsBytes, &certification)       //un stringify it aka JSON.parse()
+
+	if certification.Id != id {                                //test if certification is actually here or just nil
+		return certification, errors.New("Certification does not exist - " + id)
+	}
+	return certification, nil
+}
+
+// ============================================================================================================================
+// Put Certification - store a marble's certification
+// ============================================================================================================================
+func put_certification(stub shim.ChaincodeStubInterface, certification Certification) error {
+	key, err := stub.CreateCompositeKey("certification", []string{certification.MarbleId, certification.Id})
+	if err != nil {
+		return err
+	}
+	certificationAsBytes, _ := json.Marshal(certification)     //convert to array of bytes
+	return stub.PutState(key, certificationAsBytes)
+}
+
+// ============================================================================================================================
+// Get Mint Allowance - get a company's allowance for a color, falling back to its "*" allowance for any color
+// ============================================================================================================================
+func get_mint_allowance(stub shim.ChaincodeStubInterface, company string, color string) (MintAllowance, error) {
+	var allowance MintAllowance
+	for _, c := range []string{color, "*"} {
+		key, err := stub.CreateCompositeKey("mint_allowance", []string{company, c})
+		if err != nil {
+			return allowance, err
+		}
+		allowanceAsBytes, err := stub.GetState(key)
+		if err != nil {
+			return allowance, errors.New("Failed to get mint allowance - " + company)
+		}
+		if allowanceAsBytes != nil {
+			json.Unmarshal(allowanceAsBytes, &allowance)       //un stringify it aka JSON.parse()
+			return allowance, nil
+		}
+	}
+	return allowance, errors.New("The company '" + company + "' has no mint allowance for '" + color + "'")
+}
+
+// ============================================================================================================================
+// Put Mint Allowance - store a company's allowance for a color
+// ============================================================================================================================
+func put_mint_allowance(stub shim.ChaincodeStubInterface, allowance MintAllowance) error {
+	key, err := stub.CreateCompositeKey("mint_allowance", []string{allowance.Company, allowance.Color})
+	if err != nil {
+		return err
+	}
+	allowanceAsBytes, _ := json.Marshal(allowance)             //convert to array of bytes
+	return stub.PutState(key, allowanceAsBytes)
+}
+
+// ============================================================================================================================
+// Get Edition - get a limited edition from ledger
+// ============================================================================================================================
+func get_edition(stub shim.ChaincodeStubInterface, id string) (Edition, error) {
+	var edition Edition
+	key, err := stub.CreateCompositeKey("edition", []string{id})
+	if err != nil {
+		return edition, err
+	}
+	editionAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return edition, errors.New("Failed to get edition - " + id)
+	}
+	json.Unmarshal(editionAsBytes, &edition)                   //un stringify it aka JSON.parse()
+
+	if edition.Id != id {                                      //test if edition is actually here or just nil
+		return edition, errors.New("Edition does not exist - " + id)
+	}
+	return edition, nil
+}
+
+// ============================================================================================================================
+// Put Edition - store a limited edition
+// ============================================================================================================================
+func put_edition(stub shim.ChaincodeStubInterface, edition Edition) error {
+	key, err := stub.CreateCompositeKey("edition", []string{edition.Id})
+	if err != nil {
+		return err
+	}
+	editionAsBytes, _ := json.Marshal(edition)                 //convert to array of bytes
+	return stub.PutState(key, editionAsBytes)
+}
+
+// ============================================================================================================================
+// Count Supply - add to the minted and burned counters of a color
+// ============================================================================================================================
+func count_supply(stub shim.ChaincodeStubInterface, color string, minted int, burned int) error {
+	var supply Supply
+	key, err := stub.CreateCompositeKey("supply", []string{color})
+	if err != nil {
+		return err
+	}
+	supplyAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return errors.New("Failed to get supply - " + color)
+	}
+	json.Unmarshal(supplyAsBytes, &supply)                     //un stringify it aka JSON.parse()
+
+	supply.ObjectType = "supply"
+	supply.Color = color
+	supply.Minted += minted
+	supply.Burned += burned
+	supplyAsBytes, _ = json.Marshal(supply)                    //convert to array of bytes
+	return stub.PutState(key, supplyAsBytes)
+}
+
 // ========================================================
 // Input Sanitation - dumb input checking, look for empty strings
 // ========================================================
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Test Stub - a MockStub plus what MockStub leaves out, the creator, tx time and key history. a failed invoke rolls its
+// writes back, like a peer that never commits the transaction
+// ============================================================================================================================
+type testStub struct {
+	*shim.MockStub
+	cc      *SimpleChaincode
+	args    []string
+	txn     int
+	now     int64
+	creator []byte
+	history map[string][]historyEntry
+}
+
+type historyEntry struct {
+	txId  string
+	value []byte
+}
+
+func newTestStub() *testStub {
+	cc := new(SimpleChaincode)
+	return &testStub{
+		MockStub: shim.NewMockStub("marbles", cc),
+		cc:       cc,
+		now:      1500000000,
+		history:  map[string][]historyEntry{},
+	}
+}
+
+// invoke - run one transaction through the chaincode's Invoke(), as the current creator at the current time
+func (s *testStub) invoke(function string, args ...string) pb.Response {
+	s.txn++
+	txId := "tx" + strconv.Itoa(s.txn)
+	state, keys, history := s.snapshot()
+
+	s.args = append([]string{function}, args...)
+	s.MockTransactionStart(txId)
+	res := s.cc.Invoke(s)
+	s.MockTransactionEnd(txId)
+
+	if res.Status >= shim.ERRORTHRESHOLD {
+		s.MockStub.State, s.MockStub.Keys, s.history = state, keys, history
+	}
+	return res
+}
+
+func (s *testStub) snapshot() (map[string][]byte, *list.List, map[string][]historyEntry) {
+	state := map[string][]byte{}
+	var sorted []string
+	for key, value := range s.MockStub.State {
+		state[key] = value
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	keys := list.New()
+	for _, key := range sorted {
+		keys.PushBack(key)
+	}
+	history := map[string][]historyEntry{}
+	for key, entries := range s.history {
+		history[key] = entries
+	}
+	return state, keys, history
+}
+
+// as - submit the next transactions with a cert from an org, attrs are name/value pairs the CA puts in the cert
+func (s *testStub) as(mspId string, name string, attrs ...string) {
+	s.creator = newIdentity(mspId, name, attrs...)
+}
+
+// ----- ChaincodeStubInterface ----- //
+func (s *testStub) GetArgs() [][]byte {
+	var args [][]byte
+	for _, arg := range s.args {
+		args = append(args, []byte(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	return s.args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	return s.args[0], s.args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.now}, nil
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	s.history[key] = append(s.history[key], historyEntry{txId: s.GetTxID(), value: value})
+	return s.MockStub.PutState(key, value)
+}
+
+func (s *testStub) DelState(key string) error {
+	s.history[key] = append(s.history[key], historyEntry{txId: s.GetTxID()})
+	return s.MockStub.DelState(key)
+}
+
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{entries: s.history[key]}, nil
+}
+
+type historyIterator struct {
+	entries []historyEntry
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.entries) > 0
+}
+
+func (it *historyIterator) Next() (string, []byte, error) {
+	if len(it.entries) == 0 {
+		return "", nil, errors.New("No more history")
+	}
+	entry := it.entries[0]
+	it.entries = it.entries[1:]
+	return entry.txId, entry.value, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+// ============================================================================================================================
+// New Identity - a serialized identity with a self signed cert, carrying attributes the way fabric-ca does
+// ============================================================================================================================
+var testKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+func newIdentity(mspId string, name string, attrs ...string) []byte {
+	values := map[string]string{}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		values[attrs[i]] = attrs[i+1]
+	}
+	attrsAsBytes, _ := json.Marshal(map[string]map[string]string{"attrs": values})
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{mspId}},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(1<<32, 0),
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: attrsAsBytes},
+		},
+	}
+	certAsBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &testKey.PublicKey, testKey)
+	if err != nil {
+		panic(err)
+	}
+	identity := &msp.SerializedIdentity{
+		Mspid:   mspId,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certAsBytes}),
+	}
+	identityAsBytes, err := proto.Marshal(identity)
+	if err != nil {
+		panic(err)
+	}
+	return identityAsBytes
+}
+
+// ============================================================================================================================
+// Marbles fixtures
+// ============================================================================================================================
+const (
+	org1      = "Org1MSP"
+	org2      = "Org2MSP"
+	united    = "United Marbles"
+	marbleInc = "Marble Inc"
+)
+
+// owner - create an owner, bound to an org1 identity named after the owner's username
+func (s *testStub) owner(t *testing.T, id string, username string, company string) {
+	t.Helper()
+	s.as(org1, username)
+	checkOK(t, s.invoke("init_owner", id, username, company))
+}
+
+// admin - act as a marbles admin
+func (s *testStub) admin() {
+	s.as(org1, "admin", "marbles.role", "admin")
+}
+
+// compliance - act as a compliance officer
+func (s *testStub) compliance() {
+	s.as(org1, "officer", "marbles.role", "compliance")
+}
+
+// allow - let a company mint marbles of a color, "*" for any color
+func (s *testStub) allow(t *testing.T, company string, color string, count int) {
+	t.Helper()
+	s.admin()
+	checkOK(t, s.invoke("set_mint_allowance", company, color, strconv.Itoa(count)))
+}
+
+// marble - mint a marble for an owner, args after the company are init_marble()'s attributes
+func (s *testStub) marble(t *testing.T, id string, color string, owner_id string, company string, args ...string) {
+	t.Helper()
+	checkOK(t, s.invoke("init_marble", append([]string{id, color, "35", owner_id, company}, args...)...))
+}
+
+// stored - the marble as stored in state
+func (s *testStub) stored(t *testing.T, id string) Marble {
+	t.Helper()
+	var marble Marble
+	err := json.Unmarshal(s.MockStub.State[id], &marble)
+	if err != nil {
+		t.Fatalf("marble %s is not in state", id)
+	}
+	return marble
+}
+
+func checkOwner(t *testing.T, s *testStub, marble_id string, owner_id string) {
+	t.Helper()
+	if owner := s.stored(t, marble_id).Owner.Id; owner != owner_id {
+		t.Fatalf("expected marble %s to be owned by %s, got %s", marble_id, owner_id, owner)
+	}
+}
+
+// checkMarbleIds - the response is a json array of exactly these marbles, in order
+func checkMarbleIds(t *testing.T, res pb.Response, want ...string) {
+	t.Helper()
+	checkOK(t, res)
+	var marbles []Marble
+	json.Unmarshal(res.Payload, &marbles)
+	got := []string{}
+	for _, marble := range marbles {
+		got = append(got, marble.Id)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+// checkCertificationIds - the response is a json array of exactly these certifications, in order
+func checkCertificationIds(t *testing.T, res pb.Response, want ...string) {
+	t.Helper()
+	checkOK(t, res)
+	var certifications []Certification
+	json.Unmarshal(res.Payload, &certifications)
+	got := []string{}
+	for _, certification := range certifications {
+		got = append(got, certification.Id)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func checkOK(t *testing.T, res pb.Response) {
+	t.Helper()
+	if res.Status != shim.OK {
+		t.Fatalf("expected success, got %d - %s", res.Status, res.Message)
+	}
+}
+
+func checkError(t *testing.T, res pb.Response, status int32, text string) {
+	t.Helper()
+	if res.Status != status || !strings.Contains(res.Message, text) {
+		t.Fatalf("expected %d with '%s', got %d - %s", status, text, res.Status, res.Message)
+	}
+}
+
+func checkBalance(t *testing.T, s *testStub, owner_id string, want string) {
+	t.Helper()
+	res := s.invoke("balanceOf", owner_id)
+	checkOK(t, res)
+	if string(res.Payload) != want {
+		t.Fatalf("expected %s to have %s coins, got %s", owner_id, want, res.Payload)
+	}
+}
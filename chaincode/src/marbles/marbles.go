@@ -42,6 +42,141 @@ type Marble struct {
 	Color      string        `json:"color"`
 	Size       int           `json:"size"`    //size in mm of marble
 	Owner      OwnerRelation `json:"owner"`
+	Approved   string        `json:"approved,omitempty"` //owner id approved to transfer this marble, cleared on transfer
+	HighValue  bool          `json:"high_value,omitempty"` //high value marbles only move through a multi-sig transfer
+	Custodian  *CustodianRelation `json:"custodian,omitempty"` //set while the marble is leased out
+	Shares     map[string]int `json:"shares,omitempty"`  //cap table of a co-owned marble, owner id -> units
+	Quorum     int           `json:"quorum,omitempty"`   //percent of units that must consent to move or delete a co-owned marble
+	Attributes map[string]string `json:"attributes,omitempty"` //catalog attributes, validated against the docType's schema
+	Edition    *EditionStamp `json:"edition,omitempty"`  //set for marbles minted in a limited edition
+	InSupply   bool          `json:"in_supply,omitempty"` //counted as minted in its color's supply, marbles from before supply tracking aren't
+}
+
+// ----- Minting ----- //
+type MintAllowance struct {
+	ObjectType string `json:"docType"`     //field for couchdb
+	Company    string `json:"company"`
+	Color      string `json:"color"`       //"*" for any color
+	Remaining  int    `json:"remaining"`   //marbles the company may still mint
+}
+
+type Edition struct {
+	ObjectType string `json:"docType"`     //field for couchdb
+	Id         string `json:"id"`
+	Company    string `json:"company"`     //the only company that may mint the edition
+	Color      string `json:"color"`
+	Cap        int    `json:"cap"`         //marbles in the edition
+	Minted     int    `json:"minted"`
+}
+
+type EditionStamp struct {
+	Id         string `json:"id"`
+	Number     int    `json:"number"`
+	Cap        int    `json:"cap"`
+	Label      string `json:"label"`       //"3 of 100"
+}
+
+type Supply struct {
+	ObjectType string `json:"docType"`     //field for couchdb
+	Color      string `json:"color"`
+	Minted     int    `json:"minted"`
+	Burned     int    `json:"burned"`
+}
+
+// ----- Attribute Schemas ----- //
+type AttributeSchema struct {
+	ObjectType string                   `json:"docType"`     //field for couchdb
+	ForDocType string                   `json:"for_doc_type"` //the docType this schema validates, "marble"
+	Attributes map[string]AttributeRule `json:"attributes"`
+}
+
+type AttributeRule struct {
+	Type       string   `json:"type"`            //"string", "int", "date" (yyyy-mm-dd) or "hash" (hex sha256)
+	Required   bool     `json:"required"`
+	Enum       []string `json:"enum,omitempty"`  //allowed values, any value if empty
+	Mutable    bool     `json:"mutable"`         //can be changed by update_marble_attributes after creation
+}
+
+// ----- Fractional Ownership ----- //
+type Consent struct {
+	ObjectType string `json:"docType"`     //field for couchdb
+	MarbleId   string `json:"marble_id"`
+	HolderId   string `json:"holder_id"`
+	Action     string `json:"action"`      //"set_owner", "delete_marble" or "consolidate"
+	Target     string `json:"target"`      //owner id the action moves the marble to, "" for delete_marble
+	GivenAt    int64  `json:"given_at"`    //unix seconds
+}
+
+type CustodianRelation struct {
+	Id         string `json:"id"`          //the lessee holding the marble
+	Username   string `json:"username"`
+	Company    string `json:"company"`
+	LeasedAt   int64  `json:"leased_at"`   //unix seconds
+	ReturnBy   int64  `json:"return_by"`   //unix seconds, the lease is overdue after
+}
+
+// ----- Compliance ----- //
+type Freeze struct {
+	ObjectType string `json:"docType"`     //field for couchdb
+	Kind       string `json:"kind"`        //"marble" or "owner"
+	TargetId   string `json:"target_id"`   //id of the frozen marble or owner
+	Reason     string `json:"reason"`
+	CaseRef    string `json:"case_ref"`    //the investigation this freeze is part of
+	FrozenBy   string `json:"frozen_by"`   //msp id of the compliance officer
+	FrozenAt   int64  `json:"frozen_at"`   //unix seconds
+}
+
+type LossReport struct {
+	ObjectType    string        `json:"docType"`        //field for couchdb
+	MarbleId      string        `json:"marble_id"`
+	Status        string        `json:"status"`         //"lost" or "stolen"
+	RightfulOwner OwnerRelation `json:"rightful_owner"` //who the marble goes back to on recovery
+	ReportedBy    string        `json:"reported_by"`    //company that filed the report, and must approve recovery
+	Claim         bool          `json:"claim"`          //true if filed for a past owner, recovery then also needs compliance
+	ReportedAt    int64         `json:"reported_at"`    //unix seconds
+}
+
+// ----- Certifications ----- //
+type Certification struct {
+	ObjectType   string `json:"docType"`       //field for couchdb
+	Id           string `json:"id"`
+	MarbleId     string `json:"marble_id"`     //certifications are keyed by marble, so they follow it through set_owner
+	AppraiserMsp string `json:"appraiser_msp"` //msp id of the appraiser that signed the issuing tx
+	AppraiserId  string `json:"appraiser_id"`  //common name of the appraiser's enrollment cert
+	Grade        string `json:"grade"`
+	Value        int64  `json:"value"`         //appraised value in marble coins
+	IssuedAt     int64  `json:"issued_at"`     //unix seconds
+	ValidUntil   int64  `json:"valid_until"`   //unix seconds
+	Revoked      bool   `json:"revoked"`
+	TxId         string `json:"tx_id"`         //the issuing tx, which carries the appraiser's signature
+}
+
+// ----- Marketplace ----- //
+type Listing struct {
+	ObjectType string        `json:"docType"`     //field for couchdb
+	MarbleId   string        `json:"marble_id"`
+	Seller     OwnerRelation `json:"seller"`
+	Price      int64         `json:"price"`       //in marble coins
+	ListedAt   int64         `json:"listed_at"`   //unix seconds
+}
+
+// ----- Multi-Sig Transfers ----- //
+type CompanySigners struct {
+	ObjectType string   `json:"docType"`     //field for couchdb
+	Company    string   `json:"company"`
+	Signers    []string `json:"signers"`     //owner ids of the company's designated signers, each with its own identity
+	Threshold  int      `json:"threshold"`   //signatures needed to move a high value marble
+}
+
+type PendingTransfer struct {
+	ObjectType  string        `json:"docType"`     //field for couchdb
+	Id          string        `json:"id"`
+	MarbleId    string        `json:"marble_id"`
+	From        OwnerRelation `json:"from"`
+	To          OwnerRelation `json:"to"`
+	Signatures  []string      `json:"signatures"`  //owner ids of the signers that signed so far
+	RequestedAt int64         `json:"requested_at"`
+	ExpiresAt   int64         `json:"expires_at"`  //unix seconds, the request can no longer be signed or executed after
 }
 
 // ----- Owners ----- //
@@ -50,6 +185,7 @@ type Owner struct {
 	Id         string `json:"id"`
 	Username   string `json:"username"`
 	Company    string `json:"company"`
+	Identity   string `json:"identity,omitempty"` //"<msp id>/<enrollment id>" of the cert that created the owner and acts for it
 }
 
 type OwnerRelation struct {
@@ -58,6 +194,12 @@ type OwnerRelation struct {
 	Company    string `json:"company"`     //this is mostly cosmetic/handy, the real relation is by Id not Company
 }
 
+const (
+	LOCKED = 423                                               //the marble or owner is frozen by compliance
+)
+
+var PENDING_TRANSFER_TTL int64 = 24 * 60 * 60                 //seconds a transfer request stays open
+
 // ============================================================================================================================
 // Main
 // ============================================================================================================================
@@ -126,6 +268,90 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return init_marble(stub, args)
 	} else if function == "set_owner" {        //change owner of a marble
 		return set_owner(stub, args)
+	} else if function == "approve"{          //approve another owner to transfer a marble
+		return approve(stub, args)
+	} else if function == "set_approval_for_all"{ //make another owner an operator of all of an owner's marbles
+		return set_approval_for_all(stub, args)
+	} else if function == "getApproved"{      //read who is approved to transfer a marble
+		return getApproved(stub, args)
+	} else if function == "isApprovedForAll"{ //read if an owner is an operator for another
+		return isApprovedForAll(stub, args)
+	} else if function == "set_company_signers"{ //designate a company's signers for high value marbles
+		return set_company_signers(stub, args)
+	} else if function == "set_high_value"{   //flag a marble as high value
+		return set_high_value(stub, args)
+	} else if function == "request_transfer"{ //open a multi-sig transfer of a high value marble
+		return request_transfer(stub, args)
+	} else if function == "sign_transfer"{    //sign a pending multi-sig transfer
+		return sign_transfer(stub, args)
+	} else if function == "execute_transfer"{ //complete a multi-sig transfer once it has enough signatures
+		return execute_transfer(stub, args)
+	} else if function == "getPendingTransfer"{ //read a pending multi-sig transfer
+		return getPendingTransfer(stub, args)
+	} else if function == "lease_marble"{     //lend a marble out without changing its owner
+		return lease_marble(stub, args)
+	} else if function == "return_marble"{    //end a marble's lease
+		return return_marble(stub, args)
+	} else if function == "overdueLeases"{    //read leased marbles past their return date
+		return overdueLeases(stub)
+	} else if function == "mint"{             //create marble coins for an owner, admins only
+		return mint(stub, args)
+	} else if function == "transfer_coins"{   //move marble coins between owners
+		return transfer_coins(stub, args)
+	} else if function == "balanceOf"{        //read an owner's marble coin balance
+		return balanceOf(stub, args)
+	} else if function == "list_marble"{      //offer a marble for sale
+		return list_marble(stub, args)
+	} else if function == "delist_marble"{    //withdraw a marble from sale
+		return delist_marble(stub, args)
+	} else if function == "buy_marble"{       //pay for a listed marble and take ownership
+		return buy_marble(stub, args)
+	} else if function == "getListings"{      //read all marbles for sale
+		return getListings(stub)
+	} else if function == "split_ownership"{  //turn a marble into shares held by several owners
+		return split_ownership(stub, args)
+	} else if function == "transfer_shares"{  //move shares of a co-owned marble
+		return transfer_shares(stub, args)
+	} else if function == "consent"{          //a share holder consents to moving or deleting a co-owned marble
+		return consent(stub, args)
+	} else if function == "consolidate"{      //return a co-owned marble to a single owner
+		return consolidate(stub, args)
+	} else if function == "getMarble"{        //read a marble with its cap table
+		return getMarble(stub, args)
+	} else if function == "freeze_marble"{    //stop a marble from moving, compliance only
+		return freeze(stub, "marble", args)
+	} else if function == "freeze_owner"{     //stop everything an owner holds from moving, compliance only
+		return freeze(stub, "owner", args)
+	} else if function == "unfreeze_marble"{  //lift a marble freeze, compliance only
+		return unfreeze(stub, "marble", args)
+	} else if function == "unfreeze_owner"{   //lift an owner freeze, compliance only
+		return unfreeze(stub, "owner", args)
+	} else if function == "getFreezes"{       //read all active freezes
+		return getFreezes(stub)
+	} else if function == "report_marble"{    //flag a marble as lost or stolen
+		return report_marble(stub, args)
+	} else if function == "recover_marble"{   //return a lost or stolen marble to its rightful owner
+		return recover_marble(stub, args)
+	} else if function == "checkStatus"{      //read if a marble is safe to accept in a trade
+		return checkStatus(stub, args)
+	} else if function == "set_attribute_schema"{ //store the attribute schema for a docType, admins only
+		return set_attribute_schema(stub, args)
+	} else if function == "getAttributeSchema"{ //read the attribute schema for a docType
+		return getAttributeSchema(stub, args)
+	} else if function == "update_marble_attributes"{ //change a marble's mutable attributes
+		return update_marble_attributes(stub, args)
+	} else if function == "issue_certification"{ //an appraiser certifies a marble
+		return issue_certification(stub, args)
+	} else if function == "revoke_certification"{ //an appraiser revokes their own certification
+		return revoke_certification(stub, args)
+	} else if function == "getCertifications"{ //read a marble's valid certifications
+		return getCertifications(stub, args)
+	} else if function == "set_mint_allowance"{ //set how many marbles a company may mint, admins only
+		return set_mint_allowance(stub, args)
+	} else if function == "create_edition"{   //create a limited edition for a company, admins only
+		return create_edition(stub, args)
+	} else if function == "getSupply"{        //read minted, burned and circulating counts
+		return getSupply(stub, args)
 	} else if function == "init_owner"{        //create a new marble owner
 		return init_owner(stub, args)
 	} else if function == "read_everything"{   //read everything, (owners + marbles + companies)
@@ -23,6 +23,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -254,3 +257,453 @@ func getMarblesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Respo
 
 	return shim.Success(buffer.Bytes())
 }
+
+// ============================================================================================================================
+// Get approved - read the owner approved to transfer a marble, "" if there is none
+//
+// Inputs - Array of strings
+//       0
+//   marble id
+//  "m999999999"
+// ============================================================================================================================
+func getApproved(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type Approval struct {
+		MarbleId string `json:"marble_id"`
+		Approved string `json:"approved"`
+	}
+	var approval Approval
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	approval.MarbleId = marble.Id
+	approval.Approved = marble.Approved
+
+	//change to array of bytes
+	approvalAsBytes, _ := json.Marshal(approval)   //convert to array of bytes
+	return shim.Success(approvalAsBytes)
+}
+
+// ============================================================================================================================
+// Is approved for all - read if an owner made another owner an operator of all their marbles
+//
+// Inputs - Array of strings
+//       0       ,       1
+//   owner id    ,  operator id
+// "o99999999999", "o88888888888"
+//
+// Returns - "true" or "false"
+// ============================================================================================================================
+func isApprovedForAll(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	approved, err := is_approved_for_all(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(strconv.FormatBool(approved)))
+}
+
+// ============================================================================================================================
+// Get pending transfer - read a multi-sig transfer request, with its signature count
+//
+// Inputs - Array of strings
+//       0
+//  transfer id
+//  "t999999999"
+// ============================================================================================================================
+func getPendingTransfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type TransferStatus struct {
+		PendingTransfer
+		Signed    int  `json:"signed"`
+		Threshold int  `json:"threshold"`
+		Expired   bool `json:"expired"`
+	}
+	var status TransferStatus
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	transfer, err := get_pending_transfer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	status.PendingTransfer = transfer
+	status.Expired = now > transfer.ExpiresAt
+	signers, err := get_company_signers(stub, transfer.From.Company)
+	if err == nil {
+		status.Signed = count_signatures(transfer, signers)
+		status.Threshold = signers.Threshold
+	}
+
+	//change to array of bytes
+	statusAsBytes, _ := json.Marshal(status)       //convert to array of bytes
+	return shim.Success(statusAsBytes)
+}
+
+// ============================================================================================================================
+// Overdue leases - read all leased marbles that are past their return date
+//
+// Inputs - none
+// ============================================================================================================================
+func overdueLeases(stub shim.ChaincodeStubInterface) pb.Response {
+	var marbles []Marble
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByRange("m0", "m9999999999999999999")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, queryValAsBytes, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var marble Marble
+		json.Unmarshal(queryValAsBytes, &marble)                  //un stringify it aka JSON.parse()
+		if marble.Custodian != nil && now > marble.Custodian.ReturnBy {
+			marbles = append(marbles, marble)                      //add this marble to the list
+		}
+	}
+
+	//change to array of bytes
+	marblesAsBytes, _ := json.Marshal(marbles)                    //convert to array of bytes
+	return shim.Success(marblesAsBytes)
+}
+
+// ============================================================================================================================
+// Balance of - read an owner's marble coin balance
+//
+// Inputs - Array of strings
+//       0
+//   owner id
+// "o99999999999"
+//
+// Returns - balance as a numeric string
+// ============================================================================================================================
+func balanceOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	balance, err := get_balance(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(strconv.FormatInt(balance, 10)))
+}
+
+// ============================================================================================================================
+// Get listings - read all marbles for sale
+//
+// Inputs - none
+// ============================================================================================================================
+func getListings(stub shim.ChaincodeStubInterface) pb.Response {
+	var listings []Listing
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("listing", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, queryValAsBytes, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var listing Listing
+		json.Unmarshal(queryValAsBytes, &listing)                 //un stringify it aka JSON.parse()
+		listings = append(listings, listing)                       //add this listing to the list
+	}
+
+	//change to array of bytes
+	listingsAsBytes, _ := json.Marshal(listings)                  //convert to array of bytes
+	return shim.Success(listingsAsBytes)
+}
+
+// ============================================================================================================================
+// Get marble - read a marble with its cap table, a marble that isn't co-owned has its owner as sole holder
+//
+// Inputs - Array of strings
+//       0
+//   marble id
+//  "m999999999"
+// ============================================================================================================================
+func getMarble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type MarbleDetails struct {
+		Marble
+		CapTable    []Holding `json:"cap_table"`
+		TotalShares int       `json:"total_shares"`
+	}
+	var details MarbleDetails
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	details.Marble = marble
+
+	shares := marble.Shares
+	if shares == nil {
+		shares = map[string]int{marble.Owner.Id: 1}
+	}
+	for owner_id, units := range shares {
+		details.TotalShares += units
+		details.CapTable = append(details.CapTable, Holding{OwnerId: owner_id, Units: units})
+	}
+	sort.Sort(ByUnits(details.CapTable))
+	for i := range details.CapTable {
+		details.CapTable[i].Percent = float64(details.CapTable[i].Units) * 100 / float64(details.TotalShares)
+	}
+
+	//change to array of bytes
+	detailsAsBytes, _ := json.Marshal(details)     //convert to array of bytes
+	return shim.Success(detailsAsBytes)
+}
+
+// Holding is one line of a marble's cap table
+type Holding struct {
+	OwnerId string  `json:"owner_id"`
+	Units   int     `json:"units"`
+	Percent float64 `json:"percent"`
+}
+
+// ByUnits sorts holdings by units, largest first, then by owner id
+type ByUnits []Holding
+
+func (a ByUnits) Len() int      { return len(a) }
+func (a ByUnits) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a ByUnits) Less(i, j int) bool {
+	if a[i].Units != a[j].Units {
+		return a[i].Units > a[j].Units
+	}
+	return a[i].OwnerId < a[j].OwnerId
+}
+
+// ============================================================================================================================
+// Get freezes - read all active freezes on marbles and owners
+//
+// Inputs - none
+// ============================================================================================================================
+func getFreezes(stub shim.ChaincodeStubInterface) pb.Response {
+	var freezes []Freeze
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("freeze", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, queryValAsBytes, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var freeze Freeze
+		json.Unmarshal(queryValAsBytes, &freeze)                  //un stringify it aka JSON.parse()
+		freezes = append(freezes, freeze)                          //add this freeze to the list
+	}
+
+	//change to array of bytes
+	freezesAsBytes, _ := json.Marshal(freezes)                    //convert to array of bytes
+	return shim.Success(freezesAsBytes)
+}
+
+// ============================================================================================================================
+// Check status - read if a marble is safe to accept in a trade, and if not why
+//
+// Inputs - Array of strings
+//       0
+//   marble id
+//  "m999999999"
+//
+// Returns - status "ok", "lost" or "stolen", plus whether it's frozen or leased out
+// ============================================================================================================================
+func checkStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type MarbleStatus struct {
+		MarbleId   string        `json:"marble_id"`
+		Owner      OwnerRelation `json:"owner"`
+		Status     string        `json:"status"`
+		Report     *LossReport   `json:"report,omitempty"`
+		Frozen     bool          `json:"frozen"`
+		Leased     bool          `json:"leased"`
+	}
+	var status MarbleStatus
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	status.MarbleId = marble.Id
+	status.Owner = marble.Owner
+	status.Status = "ok"
+	status.Leased = marble.Custodian != nil
+
+	status.Report, err = get_loss_report(stub, marble.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if status.Report != nil {
+		status.Status = status.Report.Status
+	}
+
+	err = assert_not_frozen(stub, marble)
+	if _, ok := err.(FrozenError); ok {
+		status.Frozen = true
+	} else if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//change to array of bytes
+	statusAsBytes, _ := json.Marshal(status)       //convert to array of bytes
+	return shim.Success(statusAsBytes)
+}
+
+// ============================================================================================================================
+// Get attribute schema - read the attribute schema for a docType
+//
+// Inputs - Array of strings
+//      0
+//   docType
+//  "marble"
+// ============================================================================================================================
+func getAttributeSchema(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	schema, err := get_attribute_schema(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//change to array of bytes
+	schemaAsBytes, _ := json.Marshal(schema)       //convert to array of bytes
+	return shim.Success(schemaAsBytes)
+}
+
+// ============================================================================================================================
+// Get certifications - read a marble's certifications that are neither revoked nor expired
+//
+// Inputs - Array of strings
+//       0
+//   marble id
+//  "m999999999"
+// ============================================================================================================================
+func getCertifications(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var certifications []Certification
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("certification", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, queryValAsBytes, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var certification Certification
+		json.Unmarshal(queryValAsBytes, &certification)           //un stringify it aka JSON.parse()
+		if !certification.Revoked && now <= certification.ValidUntil {
+			certifications = append(certifications, certification) //add this certification to the list
+		}
+	}
+
+	//change to array of bytes
+	certificationsAsBytes, _ := json.Marshal(certifications)      //convert to array of bytes
+	return shim.Success(certificationsAsBytes)
+}
+
+// ============================================================================================================================
+// Get supply - read minted, burned and circulating marble counts, for one color or for all colors
+//
+// Inputs - Array of strings
+//     0
+//   color (optional)
+//  "blue"
+// ============================================================================================================================
+func getSupply(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type SupplyReport struct {
+		Color       string `json:"color"`
+		Minted      int    `json:"minted"`
+		Burned      int    `json:"burned"`
+		Circulating int    `json:"circulating"`
+	}
+	var report SupplyReport
+
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+
+	keys := []string{}
+	report.Color = "*"
+	if len(args) == 1 {
+		report.Color = strings.ToLower(args[0])
+		keys = []string{report.Color}
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("supply", keys)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, queryValAsBytes, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var supply Supply
+		json.Unmarshal(queryValAsBytes, &supply)                  //un stringify it aka JSON.parse()
+		report.Minted += supply.Minted
+		report.Burned += supply.Burned
+	}
+	report.Circulating = report.Minted - report.Burned
+
+	//change to array of bytes
+	reportAsBytes, _ := json.Marshal(report)                      //convert to array of bytes
+	return shim.Success(reportAsBytes)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Overdue leases - only leases past their return date are listed
+// ============================================================================================================================
+func TestOverdueLeases(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.marble(t, "m2", "red", "o1", united)
+	checkOK(t, s.invoke("lease_marble", "m1", "o2", strconv.FormatInt(s.now+60, 10), united))
+	checkOK(t, s.invoke("lease_marble", "m2", "o2", strconv.FormatInt(s.now+3600, 10), united))
+
+	checkMarbleIds(t, s.invoke("overdueLeases"))
+	s.now += 61
+	checkMarbleIds(t, s.invoke("overdueLeases"), "m1")
+}
+
+// ============================================================================================================================
+// Get marble - the cap table of a co-owned marble, largest holding first, a sole owner holds all of it
+// ============================================================================================================================
+func TestGetMarbleCapTable(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.marble(t, "m2", "red", "o1", united)
+	checkOK(t, s.invoke("split_ownership", "m1", "51", "o2", "25", "o1", "75", united))
+
+	checkCapTable(t, s.invoke("getMarble", "m1"), `[{"owner_id":"o1","units":75,"percent":75},{"owner_id":"o2","units":25,"percent":25}]`)
+	checkCapTable(t, s.invoke("getMarble", "m2"), `[{"owner_id":"o1","units":1,"percent":100}]`)
+	checkError(t, s.invoke("getMarble", "m3"), 500, "Marble does not exist")
+}
+
+func checkCapTable(t *testing.T, res pb.Response, want string) {
+	t.Helper()
+	checkOK(t, res)
+	var details struct {
+		CapTable json.RawMessage `json:"cap_table"`
+	}
+	json.Unmarshal(res.Payload, &details)
+	if string(details.CapTable) != want {
+		t.Fatalf("expected cap table %s, got %s", want, details.CapTable)
+	}
+}
+
+// ============================================================================================================================
+// Get freezes - every active freeze with its reason and case ref
+// ============================================================================================================================
+func TestGetFreezes(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.compliance()
+	checkOK(t, s.invoke("freeze_marble", "m1", "suspected fraud", "case-1"))
+
+	res := s.invoke("getFreezes")
+	checkOK(t, res)
+	var freezes []Freeze
+	json.Unmarshal(res.Payload, &freezes)
+	if len(freezes) != 1 || freezes[0].TargetId != "m1" || freezes[0].Reason != "suspected fraud" ||
+		freezes[0].CaseRef != "case-1" || freezes[0].FrozenBy != org1 || freezes[0].FrozenAt != s.now {
+		t.Fatalf("unexpected freezes %s", res.Payload)
+	}
+
+	checkOK(t, s.invoke("unfreeze_marble", "m1"))
+	res = s.invoke("getFreezes")
+	checkOK(t, res)
+	if string(res.Payload) != "null" {
+		t.Fatalf("expected no freezes, got %s", res.Payload)
+	}
+}
+
+// ============================================================================================================================
+// Check status - a would-be buyer sees reports, freezes and leases before accepting a marble
+// ============================================================================================================================
+func TestCheckStatus(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	checkStatusOf(t, s, "m1", "ok", false)
+	checkOK(t, s.invoke("report_marble", "m1", "stolen", "o1", united))
+	s.compliance()
+	checkOK(t, s.invoke("freeze_marble", "m1", "evidence", "case-1"))
+	checkStatusOf(t, s, "m1", "stolen", true)
+	checkError(t, s.invoke("checkStatus", "m9"), 500, "Marble does not exist")
+}
+
+func checkStatusOf(t *testing.T, s *testStub, marble_id string, want string, frozen bool) {
+	t.Helper()
+	res := s.invoke("checkStatus", marble_id)
+	checkOK(t, res)
+	var status struct {
+		Status string `json:"status"`
+		Frozen bool   `json:"frozen"`
+	}
+	json.Unmarshal(res.Payload, &status)
+	if status.Status != want || status.Frozen != frozen {
+		t.Fatalf("expected %s (frozen %v), got %s", want, frozen, res.Payload)
+	}
+}
+
+// ============================================================================================================================
+// Get attribute schema - the stored schema, or the default one until an admin stores one
+// ============================================================================================================================
+func TestGetAttributeSchema(t *testing.T) {
+	s := newTestStub()
+	res := s.invoke("getAttributeSchema", "marble")
+	checkOK(t, res)
+	var schema AttributeSchema
+	json.Unmarshal(res.Payload, &schema)
+	if !schema.Attributes["rarity"].Mutable || schema.Attributes["material"].Mutable {
+		t.Fatalf("unexpected default schema %s", res.Payload)
+	}
+
+	s.admin()
+	checkOK(t, s.invoke("set_attribute_schema", "marble", `{"attributes": {"serial": {"type": "int", "required": true}}}`))
+	res = s.invoke("getAttributeSchema", "marble")
+	checkOK(t, res)
+	schema = AttributeSchema{}
+	json.Unmarshal(res.Payload, &schema)
+	if len(schema.Attributes) != 1 || !schema.Attributes["serial"].Required {
+		t.Fatalf("unexpected stored schema %s", res.Payload)
+	}
+}
+
+// ============================================================================================================================
+// Get certifications - records who appraised the marble, and leaves out expired certifications
+// ============================================================================================================================
+func TestGetCertificationsLeavesOutExpired(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.as(org1, "appraiser1", "marbles.role", "appraiser")
+	checkOK(t, s.invoke("issue_certification", "c1", "m1", "A+", "250", "1"))
+	checkOK(t, s.invoke("issue_certification", "c2", "m1", "A", "200", "30"))
+
+	res := s.invoke("getCertifications", "m1")
+	checkOK(t, res)
+	var certifications []Certification
+	json.Unmarshal(res.Payload, &certifications)
+	if len(certifications) != 2 || certifications[0].AppraiserMsp != org1 || certifications[0].AppraiserId != "appraiser1" ||
+		certifications[0].Value != 250 || certifications[0].TxId == "" {
+		t.Fatalf("unexpected certifications %s", res.Payload)
+	}
+
+	s.now += 2 * 24 * 60 * 60
+	checkCertificationIds(t, s.invoke("getCertifications", "m1"), "c2")
+}
+
+// ============================================================================================================================
+// Get supply - minted, burned and circulating counts, per color or for all colors
+// ============================================================================================================================
+func TestGetSupply(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.marble(t, "m2", "blue", "o1", united)
+	s.marble(t, "m3", "red", "o1", united)
+	checkOK(t, s.invoke("delete_marble", "m1", united))
+
+	checkSupply(t, s.invoke("getSupply", "Blue"), `{"color":"blue","minted":2,"burned":1,"circulating":1}`)
+	checkSupply(t, s.invoke("getSupply"), `{"color":"*","minted":3,"burned":1,"circulating":2}`)
+	checkSupply(t, s.invoke("getSupply", "green"), `{"color":"green","minted":0,"burned":0,"circulating":0}`)
+	checkError(t, s.invoke("getSupply", "blue", "red"), 500, "Expecting 0 or 1")
+}
+
+func checkSupply(t *testing.T, res pb.Response, want string) {
+	t.Helper()
+	checkOK(t, res)
+	if string(res.Payload) != want {
+		t.Fatalf("expected supply %s, got %s", want, res.Payload)
+	}
+}
@@ -34,6 +34,8 @@ import (
 // 
 // Shows Off PutState() - writting a key/value into the ledger
 //
+// Composite keys, keys holding chaincode assets and asset values can't be written, else balances, marbles, etc could be forged
+//
 // Inputs - Array of strings
 //    0   ,    1
 //   key  ,  value
@@ -56,6 +58,24 @@ func write(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	key = args[0]                                   //rename for funsies
 	value = args[1]
+	if strings.HasPrefix(key, "\x00") {
+		return shim.Error("Cannot write to composite key")
+	}
+	existingAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var existing struct {
+		ObjectType string `json:"docType"`
+	}
+	json.Unmarshal(existingAsBytes, &existing)      //un stringify it aka JSON.parse()
+	if existing.ObjectType != "" {
+		return shim.Error("Cannot overwrite the " + existing.ObjectType + " at key - " + key)
+	}
+	json.Unmarshal([]byte(value), &existing)
+	if existing.ObjectType != "" {
+		return shim.Error("Cannot write a " + existing.ObjectType + " asset, use its own function")
+	}
 	err = stub.PutState(key, []byte(value))         //write the variable into the ledger
 	if err != nil {
 		return shim.Error(err.Error())
@@ -103,11 +123,37 @@ func delete_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response
 		return shim.Error("The company '" + authed_by_company + "' cannot authorize deletion for '" + marble.Owner.Company + "'.")
 	}
 
+	// leased marbles can't be deleted
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+
+	// co-owned marbles need their share holders' consent
+	err = check_share_quorum(stub, marble, "delete_marble", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// remove the marble
 	err = stub.DelState(id)                                                 //remove the key from chaincode state
 	if err != nil {
 		return shim.Error("Failed to delete state")
 	}
+	err = remove_listing(stub, id)                                          //a deleted marble can't be bought
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = clear_consents(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.InSupply {                                                    //only burn what was counted as minted
+		err = count_supply(stub, marble.Color, 0, 1)                       //burned
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 
 	fmt.Println("- end delete_marble")
 	return shim.Success(nil)
@@ -119,20 +165,39 @@ func delete_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response
 // Shows off building a key's JSON value manually
 //
 // Inputs - Array of strings
-//      0      ,    1  ,  2  ,      3          ,       4
-//     id      ,  color, size,     owner id    ,  authing company
-// "m999999999", "blue", "35", "o9999999999999", "united marbles"
+//      0      ,    1  ,  2  ,      3          ,       4          ,       5 ...
+//     id      ,  color, size,     owner id    ,  authing company , attributes (optional)
+// "m999999999", "blue", "35", "o9999999999999", "united marbles" , "material=glass"
+//
+// Attributes are "name=value" and are validated against the marble attribute schema, see set_attribute_schema()
+//
+// Minting uses up the company's allowance for the color, see set_mint_allowance(). the reserved attribute
+// "edition=<edition id>" mints into a limited edition instead, see create_edition(), and stamps the marble "N of M"
 // ============================================================================================================================
 func init_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
 	var err error
 	fmt.Println("starting init_marble")
 
-	if len(args) != 5 {
-		return shim.Error("Incorrect number of arguments. Expecting 5")
+	if len(args) < 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5 or more")
 	}
 
-	//input sanitation
-	err = sanitize_arguments(args)
+	//input sanitation, attributes are checked against the schema instead
+	err = sanitize_arguments(args[:5])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	attributes, err := parse_attribute_args(args[5:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	edition_id := attributes["edition"]                          //not a catalog attribute
+	delete(attributes, "edition")
+	schema, err := get_attribute_schema(stub, "marble")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = validate_attributes(schema, attributes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -166,6 +231,45 @@ func init_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 		return shim.Error("This marble already exists - " + id)  //all stop a marble by this id exists
 	}
 
+	//use up the edition or the company's allowance
+	var stamp *EditionStamp
+	if edition_id != "" {
+		edition, err := get_edition(stub, edition_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if edition.Company != owner.Company || edition.Color != color {
+			return shim.Error("Edition '" + edition.Id + "' is for " + edition.Color + " marbles of '" + edition.Company + "'.")
+		}
+		if edition.Minted >= edition.Cap {
+			return shim.Error("Edition '" + edition.Id + "' is sold out")
+		}
+		edition.Minted++
+		err = put_edition(stub, edition)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stamp = &EditionStamp{Id: edition.Id, Number: edition.Minted, Cap: edition.Cap}
+		stamp.Label = strconv.Itoa(stamp.Number) + " of " + strconv.Itoa(stamp.Cap)
+	} else {
+		allowance, err := get_mint_allowance(stub, owner.Company, color)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if allowance.Remaining <= 0 {
+			return shim.Error("The company '" + owner.Company + "' used up its mint allowance for '" + allowance.Color + "'")
+		}
+		allowance.Remaining--
+		err = put_mint_allowance(stub, allowance)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	err = count_supply(stub, color, 1, 0)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	//build the marble json string manually
 	str := `{
 		"docType":"marble", 
@@ -176,7 +280,19 @@ func init_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 			"id": "` + owner_id + `", 
 			"username": "` + owner.Username + `", 
 			"company": "` + owner.Company + `"
-		}
+		},
+		"in_supply": true`
+	if len(attributes) > 0 {
+		attributesAsBytes, _ := json.Marshal(attributes)
+		str += `,
+		"attributes": ` + string(attributesAsBytes)
+	}
+	if stamp != nil {
+		stampAsBytes, _ := json.Marshal(stamp)
+		str += `,
+		"edition": ` + string(stampAsBytes)
+	}
+	str += `
 	}`
 	err = stub.PutState(id, []byte(str))                         //store marble with id as key
 	if err != nil {
@@ -192,6 +308,8 @@ func init_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 //
 // Shows off building key's value from GoLang Structure
 //
+// The owner is bound to the identity that creates it, only that identity can sign or pay for the owner
+//
 // Inputs - Array of Strings
 //           0     ,     1   ,   2
 //      owner id   , username, company
@@ -216,6 +334,10 @@ func init_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	owner.Id =  args[0]
 	owner.Username = strings.ToLower(args[1])
 	owner.Company = args[2]
+	owner.Identity, err = get_creator_id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	fmt.Println(owner)
 
 	//check if user already exists
@@ -243,9 +365,12 @@ func init_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 // Shows off GetState() and PutState()
 //
 // Inputs - Array of Strings
-//       0     ,        1      ,        2
-//  marble id  ,  to owner id  , company that auth the transfer
-// "m999999999", "o99999999999", united_mables" 
+//       0     ,        1      ,        2                      ,          3
+//  marble id  ,  to owner id  , company that auth the transfer, initiator id (optional)
+// "m999999999", "o99999999999", united_mables"                , "o88888888888"
+//
+// Without an initiator the transfer is done for the marble's owner. an initiator that is not the owner must be approved
+// for the marble, or be an operator of the owner, and the authing company is then the initiator's
 // ============================================================================================================================
 func set_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
@@ -256,8 +381,8 @@ func set_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	// should be possible since we can now add attributes to the enrollment cert
 	// as is.. this is a bit broken (security wise), but it's much much easier to demo! holding off for demos sake
 
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or 4")
 	}
 
 	// input sanitation
@@ -278,24 +403,52 @@ func set_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	}
 
 	// get marble's current state
-	marbleAsBytes, err := stub.GetState(marble_id)
+	res, err := get_marble(stub, marble_id)
 	if err != nil {
 		return shim.Error("Failed to get marble")
 	}
-	res := Marble{}
-	json.Unmarshal(marbleAsBytes, &res)           //un stringify it aka JSON.parse()
+
+	// leased marbles can't move
+	err = assert_transferable(stub, res)
+	if err != nil {
+		return transfer_error(err)
+	}
+
+	// high value marbles need the owning company's signers, see request_transfer()
+	if res.HighValue {
+		return shim.Error("Marble '" + res.Id + "' is high value, use request_transfer")
+	}
+
+	// co-owned marbles need their share holders' consent
+	err = check_share_quorum(stub, res, "set_owner", owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// who is doing the transfer, the owner or an approved party / operator
+	var initiator_company = res.Owner.Company
+	if len(args) == 4 && args[3] != res.Owner.Id {
+		initiator, err := get_owner(stub, args[3])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		operator, err := is_approved_for_all(stub, res.Owner.Id, initiator.Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if res.Approved != initiator.Id && !operator {
+			return shim.Error("The owner '" + initiator.Id + "' is not approved to transfer marble '" + res.Id + "'.")
+		}
+		initiator_company = initiator.Company
+	}
 
 	// check authorizing company
-	if res.Owner.Company != authed_by_company{
-		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + res.Owner.Company + "'.")
+	if initiator_company != authed_by_company{
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + initiator_company + "'.")
 	}
 
 	// transfer the marble
-	res.Owner.Id = new_owner_id                   //change the owner
-	res.Owner.Username = owner.Username
-	res.Owner.Company = owner.Company
-	jsonAsBytes, _ := json.Marshal(res)           //convert to array of bytes
-	err = stub.PutState(args[0], jsonAsBytes)     //rewrite the marble with id as key
+	err = transfer_marble(stub, res, owner)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -303,3 +456,1917 @@ func set_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	fmt.Println("- end set owner")
 	return shim.Success(nil)
 }
+
+// ============================================================================================================================
+// Approve - the owner of a marble approves another owner to transfer that marble, approving the owner clears it
+//
+// Inputs - Array of Strings
+//       0     ,        1        ,        2
+//  marble id  ,  approved id    , company that auth the approval
+// "m999999999", "o99999999999"  , "united marbles"
+// ============================================================================================================================
+func approve(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting approve")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var marble_id = args[0]
+	var approved_id = args[1]
+	var authed_by_company = args[2]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize approvals for '" + marble.Owner.Company + "'.")
+	}
+
+	if approved_id == marble.Owner.Id {
+		marble.Approved = ""                          //the owner needs no approval, clear it
+	} else {
+		_, err = get_owner(stub, approved_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		marble.Approved = approved_id
+	}
+
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end approve")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Approval For All - an owner makes another owner an operator of all their marbles, or stops them being one
+//
+// Inputs - Array of Strings
+//       0       ,        1      ,      2      ,        3
+//   owner id    ,  operator id  , "true"/"false", company that auth the approval
+// "o99999999999", "o88888888888",    "true"     , "united marbles"
+// ============================================================================================================================
+func set_approval_for_all(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_approval_for_all")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var owner_id = args[0]
+	var operator_id = args[1]
+	var approved = args[2]
+	var authed_by_company = args[3]
+	if approved != "true" && approved != "false" {
+		return shim.Error("3rd argument must be 'true' or 'false'")
+	}
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = get_owner(stub, operator_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if owner.Id == operator_id {
+		return shim.Error("An owner cannot be their own operator")
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize approvals for '" + owner.Company + "'.")
+	}
+
+	key, err := operator_key(stub, owner.Id, operator_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if approved == "true" {
+		err = stub.PutState(key, []byte{0x00})        //the key is the approval, value is unused
+	} else {
+		err = stub.DelState(key)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_approval_for_all")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Company Signers - designate the owners that sign high value transfers for a company, and how many must sign
+//
+// Only for the marbles.role=admin cert attribute. Each signer must be bound to a different identity, see init_owner()
+//
+// Inputs - Array of Strings
+//         0       ,     1    ,       2       ,      3 ...
+//      company    , threshold,   signer id   ,  signer id ...
+// "united marbles",    "2"   , "o99999999999", "o88888888888"
+// ============================================================================================================================
+func set_company_signers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_company_signers")
+
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or more")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "admin")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var signers CompanySigners
+	signers.ObjectType = "company_signers"
+	signers.Company = args[0]
+	signers.Threshold, err = strconv.Atoi(args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be a numeric string")
+	}
+
+	// signers must be owners of the company, each bound to its own identity
+	signers.Signers = []string{}
+	identities := []string{}
+	for _, signer_id := range args[2:] {
+		owner, err := get_owner(stub, signer_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if owner.Company != signers.Company {
+			return shim.Error("Signer '" + signer_id + "' is not part of '" + signers.Company + "'.")
+		}
+		if contains(signers.Signers, signer_id) {
+			continue
+		}
+		if owner.Identity == "" {
+			return shim.Error("Signer '" + signer_id + "' is not bound to an identity")
+		}
+		if contains(identities, owner.Identity) {
+			return shim.Error("Signer '" + signer_id + "' shares its identity with another signer")
+		}
+		signers.Signers = append(signers.Signers, signer_id)
+		identities = append(identities, owner.Identity)
+	}
+	if signers.Threshold < 1 || signers.Threshold > len(signers.Signers) {
+		return shim.Error("Threshold must be between 1 and the number of signers")
+	}
+
+	// store the signers
+	key, err := stub.CreateCompositeKey("company_signers", []string{signers.Company})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	signersAsBytes, _ := json.Marshal(signers)                 //convert to array of bytes
+	err = stub.PutState(key, signersAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_company_signers")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set High Value - flag a marble as high value, it can then only change owners through request_transfer()
+//
+// The flag can't be cleared, otherwise the owner alone could undo the need for signatures
+//
+// Inputs - Array of Strings
+//       0     ,        1
+//  marble id  , company that auth the change
+// "m999999999", "united marbles"
+// ============================================================================================================================
+func set_high_value(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_high_value")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != args[1] {
+		return shim.Error("The company '" + args[1] + "' cannot authorize changes for '" + marble.Owner.Company + "'.")
+	}
+
+	// consolidate() would hand a co-owned marble to one owner without any signatures
+	if marble.Shares != nil {
+		return shim.Error("Marble '" + marble.Id + "' is co-owned, consolidate it first")
+	}
+
+	// without signers a high value marble could never move again
+	_, err = get_company_signers(stub, marble.Owner.Company)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble.HighValue = true
+	err = remove_listing(stub, marble.Id)                      //it can no longer be bought outright
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_high_value")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Request Transfer - open a multi-sig transfer of a high value marble, it expires if not executed in time
+//
+// Inputs - Array of Strings
+//       0      ,      1     ,        2      ,        3
+//  transfer id ,  marble id ,  to owner id  , company that auth the transfer
+// "t999999999" , "m999999999", "o99999999999", "united marbles"
+// ============================================================================================================================
+func request_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting request_transfer")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var transfer PendingTransfer
+	transfer.ObjectType = "pending_transfer"
+	transfer.Id = args[0]
+	authed_by_company := args[3]
+
+	// check if the transfer id is free
+	existingAsBytes, err := stub.GetState(transfer.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existingAsBytes != nil {
+		return shim.Error("This id already exists - " + transfer.Id)
+	}
+
+	marble, err := get_marble(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !marble.HighValue {
+		return shim.Error("Marble '" + marble.Id + "' is not high value, use set_owner")
+	}
+	if marble.Shares != nil {
+		return shim.Error("Marble '" + marble.Id + "' is co-owned, consolidate it first")
+	}
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+	owner, err := get_owner(stub, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + marble.Owner.Company + "'.")
+	}
+	_, err = get_company_signers(stub, marble.Owner.Company)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transfer.MarbleId = marble.Id
+	transfer.From = marble.Owner
+	transfer.To = OwnerRelation{Id: owner.Id, Username: owner.Username, Company: owner.Company}
+	transfer.Signatures = []string{}
+	transfer.RequestedAt = now
+	transfer.ExpiresAt = now + PENDING_TRANSFER_TTL
+
+	transferAsBytes, _ := json.Marshal(transfer)               //convert to array of bytes
+	err = stub.PutState(transfer.Id, transferAsBytes)          //store transfer with id as key
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end request_transfer")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Sign Transfer - a designated signer of the owning company signs a pending transfer
+//
+// The signer is the transaction creator, it signs for the designated signer bound to its identity
+//
+// Inputs - Array of Strings
+//       0
+//  transfer id
+// "t999999999"
+// ============================================================================================================================
+func sign_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting sign_transfer")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	creator_id, err := get_creator_id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	transfer, err := get_pending_transfer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now > transfer.ExpiresAt {
+		return shim.Error("Transfer '" + transfer.Id + "' has expired")
+	}
+
+	// find the designated signer bound to the caller
+	signers, err := get_company_signers(stub, transfer.From.Company)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	signer_id := ""
+	for _, id := range signers.Signers {
+		owner, err := get_owner(stub, id)
+		if err == nil && owner.Identity == creator_id {
+			signer_id = owner.Id
+			break
+		}
+	}
+	if signer_id == "" {
+		return shim.Error("The identity '" + creator_id + "' is not a signer for '" + transfer.From.Company + "'.")
+	}
+
+	if contains(transfer.Signatures, signer_id) {
+		return shim.Error("The owner '" + signer_id + "' already signed transfer '" + transfer.Id + "'.")
+	}
+	transfer.Signatures = append(transfer.Signatures, signer_id)
+
+	transferAsBytes, _ := json.Marshal(transfer)               //convert to array of bytes
+	err = stub.PutState(transfer.Id, transferAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end sign_transfer")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Execute Transfer - complete a pending transfer once enough of the company's signers have signed it
+//
+// Inputs - Array of Strings
+//       0      ,        1
+//  transfer id , company that auth the transfer
+// "t999999999" , "united marbles"
+// ============================================================================================================================
+func execute_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting execute_transfer")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	transfer, err := get_pending_transfer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now > transfer.ExpiresAt {
+		return shim.Error("Transfer '" + transfer.Id + "' has expired")
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if transfer.From.Company != args[1] {
+		return shim.Error("The company '" + args[1] + "' cannot authorize transfers for '" + transfer.From.Company + "'.")
+	}
+
+	// the marble must not have moved since the request
+	marble, err := get_marble(stub, transfer.MarbleId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Owner.Id != transfer.From.Id {
+		return shim.Error("Marble '" + marble.Id + "' changed owners since transfer '" + transfer.Id + "' was requested")
+	}
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+
+	// only count signers that are still designated
+	signers, err := get_company_signers(stub, transfer.From.Company)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	signed := count_signatures(transfer, signers)
+	if signed < signers.Threshold {
+		return shim.Error("Transfer '" + transfer.Id + "' has " + strconv.Itoa(signed) + " of " + strconv.Itoa(signers.Threshold) + " signatures")
+	}
+
+	owner, err := get_owner(stub, transfer.To.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = transfer_marble(stub, marble, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the request is done
+	err = stub.DelState(transfer.Id)
+	if err != nil {
+		return shim.Error("Failed to delete state")
+	}
+
+	fmt.Println("- end execute_transfer")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Lease Marble - lend a marble to another owner until a return date, the owner stays the owner
+//
+// Inputs - Array of Strings
+//       0     ,       1      ,      2      ,        3
+//  marble id  ,   lessee id  ,  return by  , company that auth the lease
+// "m999999999", "o99999999999", "1500000000", "united marbles"
+// ============================================================================================================================
+func lease_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting lease_marble")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var authed_by_company = args[3]
+	return_by, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return shim.Error("3rd argument must be a numeric string")
+	}
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	lessee, err := get_owner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize leases for '" + marble.Owner.Company + "'.")
+	}
+	if marble.Custodian != nil {
+		return shim.Error("Marble '" + marble.Id + "' is already leased to '" + marble.Custodian.Id + "'.")
+	}
+	if lessee.Id == marble.Owner.Id {
+		return shim.Error("An owner cannot lease a marble to themselves")
+	}
+	if marble.Shares != nil {
+		return shim.Error("Marble '" + marble.Id + "' is co-owned, consolidate it first")
+	}
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if return_by <= now {
+		return shim.Error("Return date must be in the future")
+	}
+
+	marble.Custodian = &CustodianRelation{
+		Id: lessee.Id,
+		Username: lessee.Username,
+		Company: lessee.Company,
+		LeasedAt: now,
+		ReturnBy: return_by,
+	}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end lease_marble")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Return Marble - end a marble's lease, the lessee can return it any time, the owner can reclaim it once overdue
+//
+// Inputs - Array of Strings
+//       0     ,        1
+//  marble id  , company that auth the return
+// "m999999999", "united marbles"
+// ============================================================================================================================
+func return_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting return_marble")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var authed_by_company = args[1]
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Custodian == nil {
+		return shim.Error("Marble '" + marble.Id + "' is not leased")
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	overdue := now > marble.Custodian.ReturnBy
+	if marble.Custodian.Company != authed_by_company && !(overdue && marble.Owner.Company == authed_by_company) {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize the return of '" + marble.Id + "'.")
+	}
+
+	marble.Custodian = nil
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end return_marble")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Mint - create marble coins in an owner's balance, only for callers with the marbles.role=admin cert attribute
+//
+// Inputs - Array of Strings
+//       0       ,   1
+//   owner id    , amount
+// "o99999999999", "100"
+// ============================================================================================================================
+func mint(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting mint")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "admin")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner, err := get_owner(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	amount, err := parse_amount(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	balance, err := get_balance(stub, owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if balance + amount < balance {
+		return shim.Error("Balance would overflow")
+	}
+	err = put_balance(stub, owner.Id, balance + amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end mint")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Transfer Coins - move marble coins from one owner to another, only the identity bound to the payer can pay
+//
+// Inputs - Array of Strings
+//       0       ,       1       ,   2
+//   from id     ,     to id     , amount
+// "o99999999999", "o88888888888", "100"
+// ============================================================================================================================
+func transfer_coins(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting transfer_coins")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	from, err := get_owner(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	to, err := get_owner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	amount, err := parse_amount(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the payer must sign for themselves
+	err = check_owner_identity(stub, from)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assert_owner_not_frozen(stub, from.Id)
+	if err != nil {
+		return transfer_error(err)
+	}
+
+	err = move_coins(stub, from.Id, to.Id, amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end transfer_coins")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// List Marble - offer a marble for sale at a price in marble coins, listing again changes the price
+//
+// Inputs - Array of Strings
+//       0     ,   1  ,        2
+//  marble id  , price, company that auth the listing
+// "m999999999", "100", "united marbles"
+// ============================================================================================================================
+func list_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting list_marble")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var authed_by_company = args[2]
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	price, err := parse_amount(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize sales for '" + marble.Owner.Company + "'.")
+	}
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+	if marble.HighValue {
+		return shim.Error("Marble '" + marble.Id + "' is high value, use request_transfer")
+	}
+	if marble.Shares != nil {
+		return shim.Error("Marble '" + marble.Id + "' is co-owned, consolidate it first")
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var listing Listing
+	listing.ObjectType = "listing"
+	listing.MarbleId = marble.Id
+	listing.Seller = marble.Owner
+	listing.Price = price
+	listing.ListedAt = now
+
+	key, err := stub.CreateCompositeKey("listing", []string{marble.Id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	listingAsBytes, _ := json.Marshal(listing)                 //convert to array of bytes
+	err = stub.PutState(key, listingAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end list_marble")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Delist Marble - withdraw a marble from sale
+//
+// Inputs - Array of Strings
+//       0     ,        1
+//  marble id  , company that auth the delisting
+// "m999999999", "united marbles"
+// ============================================================================================================================
+func delist_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting delist_marble")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	listing, err := get_listing(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if listing.Seller.Company != args[1] {
+		return shim.Error("The company '" + args[1] + "' cannot authorize sales for '" + listing.Seller.Company + "'.")
+	}
+
+	err = remove_listing(stub, listing.MarbleId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end delist_marble")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Buy Marble - pay the listed price to the seller and take ownership, all in this one transaction
+//
+// Inputs - Array of Strings
+//       0     ,       1       ,   2
+//  marble id  ,    buyer id   , price
+// "m999999999", "o99999999999", "100"
+//
+// The price is the one the buyer agreed to, the purchase fails if the listing changed to anything else
+// Only the identity bound to the buyer can buy with the buyer's coins
+// ============================================================================================================================
+func buy_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting buy_marble")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	listing, err := get_listing(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	buyer, err := get_owner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	price, err := parse_amount(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if price != listing.Price {
+		return shim.Error("Marble '" + listing.MarbleId + "' is listed at " + strconv.FormatInt(listing.Price, 10))
+	}
+
+	// the buyer must pay for themselves
+	err = check_owner_identity(stub, buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the marble must still be the seller's and free to move
+	marble, err := get_marble(stub, listing.MarbleId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Owner.Id != listing.Seller.Id {
+		return shim.Error("Marble '" + marble.Id + "' changed owners since it was listed")
+	}
+	if buyer.Id == marble.Owner.Id {
+		return shim.Error("An owner cannot buy their own marble")
+	}
+	if marble.HighValue {
+		return shim.Error("Marble '" + marble.Id + "' is high value, use request_transfer")
+	}
+	if marble.Shares != nil {
+		return shim.Error("Marble '" + marble.Id + "' is co-owned, consolidate it first")
+	}
+	err = assert_owner_not_frozen(stub, buyer.Id)
+	if err != nil {
+		return transfer_error(err)
+	}
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+
+	// pay, then transfer, either both happen or the tx fails
+	err = move_coins(stub, buyer.Id, listing.Seller.Id, listing.Price)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = transfer_marble(stub, marble, buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end buy_marble")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Split Ownership - turn a marble into shares held by several owners, the marble's owner stays its owner of record
+//
+// Inputs - Array of Strings
+//       0     ,    1   ,       2       ,  3   ,       4 ...   , 5 ... ,        last
+//  marble id  , quorum ,    owner id   , units,    owner id   , units , company that auth the split
+// "m999999999",  "51"  , "o99999999999", "60" , "o88888888888", "40"  , "united marbles"
+//
+// Quorum is the percent of units (51-100) whose holders must consent to set_owner, delete_marble or consolidate
+// ============================================================================================================================
+func split_ownership(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting split_ownership")
+
+	if len(args) < 5 || len(args) % 2 != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting marble id, quorum, owner id/units pairs and company")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var authed_by_company = args[len(args) - 1]
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	quorum, err := strconv.Atoi(args[1])
+	if err != nil || quorum < 51 || quorum > 100 {
+		return shim.Error("2nd argument must be a numeric string between 51 and 100")
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize splits for '" + marble.Owner.Company + "'.")
+	}
+	if marble.Shares != nil {
+		return shim.Error("Marble '" + marble.Id + "' is already co-owned")
+	}
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+	if marble.HighValue {
+		return shim.Error("Marble '" + marble.Id + "' is high value and can't be split")
+	}
+
+	// build the cap table
+	shares := map[string]int{}
+	for i := 2; i < len(args) - 1; i += 2 {
+		holder, err := get_owner(stub, args[i])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		units, err := strconv.Atoi(args[i + 1])
+		if err != nil || units <= 0 {
+			return shim.Error("Units for '" + holder.Id + "' must be a positive numeric string")
+		}
+		shares[holder.Id] += units
+	}
+
+	marble.Shares = shares
+	marble.Quorum = quorum
+	err = clear_consents(stub, marble.Id)                      //nothing from before the split counts
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = remove_listing(stub, marble.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end split_ownership")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Transfer Shares - move units of a co-owned marble from one holder to another owner
+//
+// Inputs - Array of Strings
+//       0     ,       1       ,       2       ,   3  ,        4
+//  marble id  ,    from id    ,     to id     , units, company that auth the transfer
+// "m999999999", "o99999999999", "o88888888888", "10" , "united marbles"
+// ============================================================================================================================
+func transfer_shares(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting transfer_shares")
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var authed_by_company = args[4]
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Shares == nil {
+		return shim.Error("Marble '" + marble.Id + "' is not co-owned")
+	}
+	from, err := get_owner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	to, err := get_owner(stub, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	units, err := strconv.Atoi(args[3])
+	if err != nil || units <= 0 {
+		return shim.Error("4th argument must be a positive numeric string")
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if from.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + from.Company + "'.")
+	}
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+	if marble.Shares[from.Id] < units {
+		return shim.Error("The owner '" + from.Id + "' holds " + strconv.Itoa(marble.Shares[from.Id]) + " units")
+	}
+
+	marble.Shares[from.Id] -= units
+	marble.Shares[to.Id] += units
+	if marble.Shares[from.Id] == 0 {
+		delete(marble.Shares, from.Id)
+		key, err := consent_key(stub, marble.Id, from.Id)     //a former holder has no say
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.DelState(key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end transfer_shares")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Consent - a share holder consents to an action on a co-owned marble, replacing their earlier consent
+//
+// Inputs - Array of Strings
+//       0     ,       1       ,      2     ,       3       ,        4
+//  marble id  ,   holder id   ,   action   ,  target id    , company that auth the consent
+// "m999999999", "o99999999999", "set_owner", "o88888888888", "united marbles"
+//
+// Action is "set_owner" or "consolidate" with the owner id the marble goes to, or "delete_marble" with "-" as target
+// ============================================================================================================================
+func consent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting consent")
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var consent Consent
+	consent.ObjectType = "consent"
+	consent.Action = args[2]
+	consent.Target = args[3]
+	var authed_by_company = args[4]
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	holder, err := get_owner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Shares[holder.Id] == 0 {
+		return shim.Error("The owner '" + holder.Id + "' holds no shares of marble '" + marble.Id + "'.")
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if holder.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize consent for '" + holder.Company + "'.")
+	}
+
+	if consent.Action == "delete_marble" {
+		consent.Target = ""
+	} else if consent.Action == "set_owner" || consent.Action == "consolidate" {
+		_, err = get_owner(stub, consent.Target)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	} else {
+		return shim.Error("Action must be 'set_owner', 'delete_marble' or 'consolidate'")
+	}
+
+	consent.GivenAt, err = get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	consent.MarbleId = marble.Id
+	consent.HolderId = holder.Id
+
+	key, err := consent_key(stub, marble.Id, holder.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	consentAsBytes, _ := json.Marshal(consent)                 //convert to array of bytes
+	err = stub.PutState(key, consentAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end consent")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Consolidate - return a co-owned marble to a single owner, once its quorum of share holders consented
+//
+// Inputs - Array of Strings
+//       0     ,       1       ,        2
+//  marble id  ,    owner id   , company that auth the consolidation
+// "m999999999", "o99999999999", "united marbles"
+// ============================================================================================================================
+func consolidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting consolidate")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var authed_by_company = args[2]
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Shares == nil {
+		return shim.Error("Marble '" + marble.Id + "' is not co-owned")
+	}
+	owner, err := get_owner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize consolidation for '" + owner.Company + "'.")
+	}
+	err = assert_transferable(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+	err = check_share_quorum(stub, marble, "consolidate", owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = transfer_marble(stub, marble, owner)                 //drops the cap table
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end consolidate")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Freeze - stop a marble, or everything an owner holds, from moving, only for the marbles.role=compliance cert attribute
+//
+// Inputs - Array of Strings
+//       0      ,           1           ,     2
+//  marble id   ,        reason         , case ref
+// "m999999999" , "suspected fraud"     , "case-2017-042"
+//
+// Kind is "marble" for freeze_marble and "owner" for freeze_owner, where arg 0 is the owner id. freezing again replaces
+// the reason and case ref
+// ============================================================================================================================
+func freeze(stub shim.ChaincodeStubInterface, kind string, args []string) pb.Response {
+	var err error
+	fmt.Println("starting freeze_" + kind)
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation, the reason may be longer than an id
+	err = sanitize_arguments([]string{args[0], args[2]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[1]) == 0 || len(args[1]) > 256 {
+		return shim.Error("Reason must be a non-empty string <= 256 characters")
+	}
+
+	err = check_role(stub, "compliance")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var freeze Freeze
+	freeze.ObjectType = "freeze"
+	freeze.Kind = kind
+	freeze.Reason = args[1]
+	freeze.CaseRef = args[2]
+	if kind == "marble" {
+		marble, err := get_marble(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		freeze.TargetId = marble.Id
+	} else {
+		owner, err := get_owner(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		freeze.TargetId = owner.Id
+	}
+
+	identity, err := get_creator(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	freeze.FrozenBy = identity.Mspid
+	freeze.FrozenAt, err = get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey("freeze", []string{kind, freeze.TargetId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	freezeAsBytes, _ := json.Marshal(freeze)                   //convert to array of bytes
+	err = stub.PutState(key, freezeAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end freeze_" + kind)
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Unfreeze - lift the freeze on a marble or owner, only for the marbles.role=compliance cert attribute
+//
+// The freeze stays in the freeze key's history on the ledger
+//
+// Inputs - Array of Strings
+//       0
+//  marble id (or owner id)
+// "m999999999"
+// ============================================================================================================================
+func unfreeze(stub shim.ChaincodeStubInterface, kind string, args []string) pb.Response {
+	var err error
+	fmt.Println("starting unfreeze_" + kind)
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "compliance")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	freeze, err := get_freeze(stub, kind, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if freeze == nil {
+		return shim.Error("The " + kind + " '" + args[0] + "' is not frozen")
+	}
+
+	key, err := stub.CreateCompositeKey("freeze", []string{kind, args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return shim.Error("Failed to delete state")
+	}
+
+	fmt.Println("- end unfreeze_" + kind)
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Report Marble - flag a marble as lost or stolen, it can't move until recover_marble()
+//
+// Normally filed by the current owner. A past owner's claim on a marble that already moved on without them
+// needs the marbles.role=compliance cert attribute, the claimant can't approve their own claim
+//
+// Inputs - Array of Strings
+//       0     ,     1     ,         2        ,        3
+//  marble id  ,   status  , rightful owner id, company that auth the report
+// "m999999999", "stolen"  ,  "o99999999999"  , "united marbles"
+// ============================================================================================================================
+func report_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting report_marble")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var report LossReport
+	report.ObjectType = "loss_report"
+	report.Status = args[1]
+	report.ReportedBy = args[3]
+	if report.Status != "lost" && report.Status != "stolen" {
+		return shim.Error("2nd argument must be 'lost' or 'stolen'")
+	}
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	owner, err := get_owner(stub, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != report.ReportedBy {
+		return shim.Error("The company '" + report.ReportedBy + "' cannot authorize reports for '" + owner.Company + "'.")
+	}
+
+	// a past owner's claim must be approved by compliance
+	if marble.Owner.Id != owner.Id {
+		err = check_role(stub, "compliance")
+		if err != nil {
+			return shim.Error("Only the current owner can report marble '" + marble.Id + "', past owner claims need compliance. " + err.Error())
+		}
+		owned, err := was_owner(stub, marble.Id, owner.Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !owned {
+			return shim.Error("The owner '" + owner.Id + "' never owned marble '" + marble.Id + "'.")
+		}
+		report.Claim = true
+	}
+
+	existing, err := get_loss_report(stub, marble.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Marble '" + marble.Id + "' is already reported " + existing.Status)
+	}
+
+	report.MarbleId = marble.Id
+	report.RightfulOwner = OwnerRelation{Id: owner.Id, Username: owner.Username, Company: owner.Company}
+	report.ReportedAt, err = get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey("loss_report", []string{marble.Id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	reportAsBytes, _ := json.Marshal(report)                   //convert to array of bytes
+	err = stub.PutState(key, reportAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = remove_listing(stub, marble.Id)                      //a flagged marble can't be bought
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end report_marble")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Recover Marble - clear a lost/stolen report and return the marble to its rightful owner, wherever it is now
+//
+// Ends any lease and drops any cap table the marble picked up, a compliance freeze still applies
+// Recovering a past owner's claim also needs the marbles.role=compliance cert attribute
+//
+// Inputs - Array of Strings
+//       0     ,        1
+//  marble id  , company that filed the report
+// "m999999999", "united marbles"
+// ============================================================================================================================
+func recover_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting recover_marble")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	report, err := get_loss_report(stub, marble.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if report == nil {
+		return shim.Error("Marble '" + marble.Id + "' is not reported lost or stolen")
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if report.ReportedBy != args[1] {
+		return shim.Error("The company '" + args[1] + "' cannot authorize recovery, the report was filed by '" + report.ReportedBy + "'.")
+	}
+	if report.Claim {
+		err = check_role(stub, "compliance")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	err = assert_not_frozen(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+
+	owner, err := get_owner(stub, report.RightfulOwner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	marble.Custodian = nil
+	err = transfer_marble(stub, marble, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey("loss_report", []string{marble.Id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return shim.Error("Failed to delete state")
+	}
+
+	fmt.Println("- end recover_marble")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Attribute Schema - store the attribute schema for a docType, only for the marbles.role=admin cert attribute
+//
+// Marbles already on the ledger are not revalidated, the schema applies to the next init_marble or update
+//
+// Inputs - Array of Strings
+//       0    ,     1
+//    docType , schema json
+//   "marble" , "{"attributes": {"rarity": {"type": "string", "required": true, "enum": ["common", "rare"], "mutable": true}}}"
+// ============================================================================================================================
+func set_attribute_schema(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_attribute_schema")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation, the schema is json of any length
+	err = sanitize_arguments(args[:1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "admin")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var schema AttributeSchema
+	err = json.Unmarshal([]byte(args[1]), &schema)
+	if err != nil {
+		return shim.Error("2nd argument must be a json attribute schema")
+	}
+	schema.ObjectType = "attribute_schema"
+	schema.ForDocType = args[0]
+	if schema.Attributes == nil {
+		schema.Attributes = map[string]AttributeRule{}
+	}
+
+	// every rule must have a known type, and its enum values must pass it
+	for name, rule := range schema.Attributes {
+		if len(name) == 0 || strings.Contains(name, "=") {
+			return shim.Error("Attribute names must be non-empty and can't contain '='")
+		}
+		if !contains([]string{"string", "int", "date", "hash"}, rule.Type) {
+			return shim.Error("Attribute '" + name + "' has unknown type '" + rule.Type + "'")
+		}
+		for _, value := range rule.Enum {
+			err = validate_attribute(name, AttributeRule{Type: rule.Type}, value)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+
+	key, err := stub.CreateCompositeKey("attribute_schema", []string{schema.ForDocType})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	schemaAsBytes, _ := json.Marshal(schema)                   //convert to array of bytes
+	err = stub.PutState(key, schemaAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_attribute_schema")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Update Marble Attributes - set or remove a marble's mutable attributes, "name=" removes one
+//
+// Immutable attributes can only be given at init_marble
+//
+// Inputs - Array of Strings
+//       0     ,        1         ,        2 ...
+//  marble id  , authing company  , attributes
+// "m999999999", "united marbles" , "rarity=rare"
+// ============================================================================================================================
+func update_marble_attributes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting update_marble_attributes")
+
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or more")
+	}
+
+	// input sanitation, attributes are checked against the schema instead
+	err = sanitize_arguments(args[:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	updates, err := parse_attribute_args(args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble, err := get_marble(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != args[1] {
+		return shim.Error("The company '" + args[1] + "' cannot authorize changes for '" + marble.Owner.Company + "'.")
+	}
+	err = assert_not_frozen(stub, marble)
+	if err != nil {
+		return transfer_error(err)
+	}
+
+	schema, err := get_attribute_schema(stub, marble.ObjectType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	attributes := map[string]string{}
+	for name, value := range marble.Attributes {
+		attributes[name] = value
+	}
+	for name, value := range updates {
+		rule, ok := schema.Attributes[name]
+		if !ok {
+			return shim.Error("Attribute '" + name + "' is not in the " + schema.ForDocType + " schema")
+		}
+		if !rule.Mutable {
+			return shim.Error("Attribute '" + name + "' can't be changed after creation")
+		}
+		if value == "" {
+			delete(attributes, name)
+		} else {
+			attributes[name] = value
+		}
+	}
+	err = validate_attributes(schema, attributes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble.Attributes = attributes
+	if len(attributes) == 0 {
+		marble.Attributes = nil
+	}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end update_marble_attributes")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Issue Certification - an appraiser certifies a marble's grade and value, only for the marbles.role=appraiser cert attribute
+//
+// The appraiser is recorded from the tx creator's msp and cert, so the certification is signed by the issuing tx
+//
+// Inputs - Array of Strings
+//         0        ,      1      ,   2  ,   3  ,       4
+//  certification id,   marble id , grade, value, valid for days
+//   "c999999999"   , "m999999999", "A+" , "250", "365"
+// ============================================================================================================================
+func issue_certification(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting issue_certification")
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "appraiser")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var certification Certification
+	certification.ObjectType = "certification"
+	certification.Id = args[0]
+	certification.Grade = args[2]
+	certification.Value, err = parse_amount(args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	days, err := strconv.Atoi(args[4])
+	if err != nil || days <= 0 {
+		return shim.Error("5th argument must be a positive numeric string")
+	}
+
+	marble, err := get_marble(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	certification.MarbleId = marble.Id
+	_, err = get_certification(stub, marble.Id, certification.Id)
+	if err == nil {
+		return shim.Error("This certification already exists - " + certification.Id)
+	}
+
+	// who is the appraiser
+	identity, err := get_creator(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	cert, err := get_creator_cert(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	certification.AppraiserMsp = identity.Mspid
+	certification.AppraiserId = cert.Subject.CommonName
+
+	certification.IssuedAt, err = get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	certification.ValidUntil = certification.IssuedAt + int64(days) * 24 * 60 * 60
+	certification.TxId = stub.GetTxID()
+
+	err = put_certification(stub, certification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end issue_certification")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Revoke Certification - an appraiser revokes a certification they issued
+//
+// Inputs - Array of Strings
+//       0     ,        1
+//  marble id  , certification id
+// "m999999999", "c999999999"
+// ============================================================================================================================
+func revoke_certification(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting revoke_certification")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "appraiser")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	certification, err := get_certification(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only the issuing appraiser may revoke
+	identity, err := get_creator(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	cert, err := get_creator_cert(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if certification.AppraiserMsp != identity.Mspid || certification.AppraiserId != cert.Subject.CommonName {
+		return shim.Error("Certification '" + certification.Id + "' was issued by another appraiser")
+	}
+	if certification.Revoked {
+		return shim.Error("Certification '" + certification.Id + "' is already revoked")
+	}
+
+	certification.Revoked = true
+	err = put_certification(stub, certification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end revoke_certification")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Mint Allowance - set how many more marbles of a color a company may mint, only for the marbles.role=admin cert attribute
+//
+// Inputs - Array of Strings
+//         0       ,   1   ,   2
+//      company    , color , allowance
+// "united marbles", "blue", "100"
+//
+// Color "*" sets the allowance used for colors without their own
+// ============================================================================================================================
+func set_mint_allowance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_mint_allowance")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "admin")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var allowance MintAllowance
+	allowance.ObjectType = "mint_allowance"
+	allowance.Company = args[0]
+	allowance.Color = strings.ToLower(args[1])
+	allowance.Remaining, err = strconv.Atoi(args[2])
+	if err != nil || allowance.Remaining < 0 {
+		return shim.Error("3rd argument must be a non-negative numeric string")
+	}
+
+	err = put_mint_allowance(stub, allowance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_mint_allowance")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Create Edition - create a limited edition of a color for a company, only for the marbles.role=admin cert attribute
+//
+// Inputs - Array of Strings
+//        0    ,        1        ,   2   ,  3
+//   edition id,     company     , color , cap
+// "e999999999", "united marbles", "blue", "100"
+// ============================================================================================================================
+func create_edition(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting create_edition")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "admin")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var edition Edition
+	edition.ObjectType = "edition"
+	edition.Id = args[0]
+	edition.Company = args[1]
+	edition.Color = strings.ToLower(args[2])
+	edition.Cap, err = strconv.Atoi(args[3])
+	if err != nil || edition.Cap <= 0 {
+		return shim.Error("4th argument must be a positive numeric string")
+	}
+
+	_, err = get_edition(stub, edition.Id)
+	if err == nil {
+		return shim.Error("This edition already exists - " + edition.Id)
+	}
+
+	err = put_edition(stub, edition)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end create_edition")
+	return shim.Success(nil)
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+// ============================================================================================================================
+// Approvals - an approved owner or an operator can transfer, the approval is cleared on transfer
+// ============================================================================================================================
+func TestApprovedOwnerTransfers(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.owner(t, "o3", "carol", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	checkOK(t, s.invoke("approve", "m1", "o2", united))
+	res := s.invoke("getApproved", "m1")
+	checkOK(t, res)
+	if string(res.Payload) != `{"marble_id":"m1","approved":"o2"}` {
+		t.Fatalf("unexpected approval %s", res.Payload)
+	}
+
+	checkOK(t, s.invoke("set_owner", "m1", "o3", marbleInc, "o2"))
+	checkOwner(t, s, "m1", "o3")
+	if s.stored(t, "m1").Approved != "" {
+		t.Fatalf("approval survived the transfer")
+	}
+}
+
+func TestOperatorTransfersAllMarbles(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.marble(t, "m2", "red", "o1", united)
+
+	checkOK(t, s.invoke("set_approval_for_all", "o1", "o2", "true", united))
+	res := s.invoke("isApprovedForAll", "o1", "o2")
+	checkOK(t, res)
+	if string(res.Payload) != "true" {
+		t.Fatalf("expected o2 to be an operator of o1")
+	}
+	checkOK(t, s.invoke("set_owner", "m1", "o2", marbleInc, "o2"))
+	checkOwner(t, s, "m1", "o2")
+
+	checkOK(t, s.invoke("set_approval_for_all", "o1", "o2", "false", united))
+	checkError(t, s.invoke("set_owner", "m2", "o2", marbleInc, "o2"), 500, "is not approved")
+}
+
+func TestApprovalRefusals(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	checkError(t, s.invoke("set_owner", "m1", "o2", marbleInc, "o2"), 500, "is not approved")
+	checkError(t, s.invoke("approve", "m1", "o2", marbleInc), 500, "cannot authorize approvals")
+	checkError(t, s.invoke("set_approval_for_all", "o1", "o1", "true", united), 500, "their own operator")
+
+	checkOK(t, s.invoke("approve", "m1", "o2", united))
+	checkError(t, s.invoke("set_owner", "m1", "o2", united, "o2"), 500, "cannot authorize transfers")
+	checkOwner(t, s, "m1", "o1")
+}
+
+// ============================================================================================================================
+// Multi-sig transfers - a high value marble moves once enough of its company's signers sign, each as itself
+// ============================================================================================================================
+func highValueMarble(t *testing.T) *testStub {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.owner(t, "s1", "ann", united)
+	s.owner(t, "s2", "sam", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.admin()
+	checkOK(t, s.invoke("set_company_signers", united, "2", "s1", "s2"))
+	checkOK(t, s.invoke("set_high_value", "m1", united))
+	return s
+}
+
+func TestMultiSigTransfer(t *testing.T) {
+	s := highValueMarble(t)
+	checkError(t, s.invoke("set_owner", "m1", "o2", united), 500, "use request_transfer")
+	checkOK(t, s.invoke("request_transfer", "t1", "m1", "o2", united))
+
+	s.as(org1, "ann")
+	checkOK(t, s.invoke("sign_transfer", "t1"))
+	checkError(t, s.invoke("sign_transfer", "t1"), 500, "already signed")
+	checkError(t, s.invoke("execute_transfer", "t1", united), 500, "has 1 of 2 signatures")
+
+	s.as(org1, "sam")
+	checkOK(t, s.invoke("sign_transfer", "t1"))
+	checkOK(t, s.invoke("execute_transfer", "t1", united))
+	checkOwner(t, s, "m1", "o2")
+	if s.MockStub.State["t1"] != nil {
+		t.Fatalf("executed transfer is still pending")
+	}
+}
+
+func TestMultiSigRefusals(t *testing.T) {
+	s := highValueMarble(t)
+	checkOK(t, s.invoke("request_transfer", "t1", "m1", "o2", united))
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("sign_transfer", "t1"), 500, "is not a signer")
+	checkError(t, s.invoke("set_company_signers", united, "1", "o1"), 500, "does not have the marbles role")
+
+	s.admin()
+	checkError(t, s.invoke("set_company_signers", united, "1", "o2"), 500, "is not part of")
+	checkError(t, s.invoke("set_company_signers", united, "3", "s1", "s2"), 500, "Threshold must be")
+
+	s.now += PENDING_TRANSFER_TTL + 1
+	s.as(org1, "ann")
+	checkError(t, s.invoke("sign_transfer", "t1"), 500, "has expired")
+	checkOwner(t, s, "m1", "o1")
+}
+
+// ============================================================================================================================
+// Leasing - the lessee holds the marble without owning it, it can't move or be deleted until returned
+// ============================================================================================================================
+func TestLeaseAndReturnMarble(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	return_by := strconv.FormatInt(s.now+3600, 10)
+	checkOK(t, s.invoke("lease_marble", "m1", "o2", return_by, united))
+	marble := s.stored(t, "m1")
+	if marble.Custodian == nil || marble.Custodian.Id != "o2" || marble.Owner.Id != "o1" {
+		t.Fatalf("unexpected lease %+v", marble)
+	}
+
+	checkError(t, s.invoke("set_owner", "m1", "o2", united), 500, "must be returned first")
+	checkError(t, s.invoke("delete_marble", "m1", united), 500, "must be returned first")
+	checkError(t, s.invoke("lease_marble", "m1", "o2", return_by, united), 500, "already leased")
+
+	checkOK(t, s.invoke("return_marble", "m1", marbleInc))
+	if s.stored(t, "m1").Custodian != nil {
+		t.Fatalf("returned marble still has a custodian")
+	}
+	checkOK(t, s.invoke("set_owner", "m1", "o2", united))
+}
+
+func TestLeaseRefusals(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	checkError(t, s.invoke("lease_marble", "m1", "o2", strconv.FormatInt(s.now, 10), united), 500, "must be in the future")
+	checkError(t, s.invoke("lease_marble", "m1", "o2", strconv.FormatInt(s.now+60, 10), marbleInc), 500, "cannot authorize leases")
+	checkError(t, s.invoke("lease_marble", "m1", "o1", strconv.FormatInt(s.now+60, 10), united), 500, "to themselves")
+
+	checkOK(t, s.invoke("lease_marble", "m1", "o2", strconv.FormatInt(s.now+60, 10), united))
+	checkError(t, s.invoke("return_marble", "m1", united), 500, "cannot authorize the return")
+	s.now += 61
+	checkOK(t, s.invoke("return_marble", "m1", united))
+}
+
+// ============================================================================================================================
+// Marble coins - admins mint, only the identity bound to the payer can pay
+// ============================================================================================================================
+func TestMintAndTransferCoins(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.admin()
+	checkOK(t, s.invoke("mint", "o1", "100"))
+
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("transfer_coins", "o1", "o2", "30"))
+	checkBalance(t, s, "o1", "70")
+	checkBalance(t, s, "o2", "30")
+	checkError(t, s.invoke("transfer_coins", "o1", "o2", "71"), 500, "Insufficient balance")
+}
+
+func TestCoinRefusals(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("mint", "o1", "100"), 500, "does not have the marbles role")
+	s.admin()
+	checkOK(t, s.invoke("mint", "o1", "100"))
+
+	s.as(org1, "bob")
+	checkError(t, s.invoke("transfer_coins", "o1", "o2", "30"), 500, "cannot act for owner")
+	checkError(t, s.invoke("write", "\x00balance\x00o2\x00", "1000"), 500, "composite key")
+	checkError(t, s.invoke("write", "o2", "1000"), 500, "Cannot overwrite the marble_owner")
+	checkError(t, s.invoke("write", "m9", `{"docType":"marble"}`), 500, "use its own function")
+	checkBalance(t, s, "o2", "0")
+}
+
+// ============================================================================================================================
+// Marketplace - buying pays the seller and moves the marble in one transaction
+// ============================================================================================================================
+func TestBuyListedMarble(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.admin()
+	checkOK(t, s.invoke("mint", "o2", "100"))
+
+	checkOK(t, s.invoke("list_marble", "m1", "40", united))
+	s.as(org1, "bob")
+	checkError(t, s.invoke("buy_marble", "m1", "o2", "30"), 500, "is listed at 40")
+	checkOK(t, s.invoke("buy_marble", "m1", "o2", "40"))
+
+	checkOwner(t, s, "m1", "o2")
+	checkBalance(t, s, "o1", "40")
+	checkBalance(t, s, "o2", "60")
+	checkError(t, s.invoke("buy_marble", "m1", "o2", "40"), 500, "not listed")
+}
+
+func TestBuyRefusals(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.admin()
+	checkOK(t, s.invoke("mint", "o2", "10"))
+	checkError(t, s.invoke("list_marble", "m1", "40", marbleInc), 500, "cannot authorize sales")
+	checkOK(t, s.invoke("list_marble", "m1", "40", united))
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("buy_marble", "m1", "o2", "40"), 500, "cannot act for owner")
+	s.as(org1, "bob")
+	checkError(t, s.invoke("buy_marble", "m1", "o2", "40"), 500, "Insufficient balance")
+	checkOwner(t, s, "m1", "o1")
+	checkBalance(t, s, "o2", "10")
+
+	checkOK(t, s.invoke("delist_marble", "m1", united))
+	checkError(t, s.invoke("buy_marble", "m1", "o2", "40"), 500, "not listed")
+}
+
+// ============================================================================================================================
+// Fractional ownership - moving or deleting a co-owned marble needs consent from its quorum of units
+// ============================================================================================================================
+func coOwnedMarble(t *testing.T) *testStub {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.owner(t, "o3", "carol", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	checkOK(t, s.invoke("split_ownership", "m1", "60", "o1", "50", "o2", "30", "o3", "20", united))
+	return s
+}
+
+func TestCoOwnedMarbleMovesWithQuorum(t *testing.T) {
+	s := coOwnedMarble(t)
+	checkOK(t, s.invoke("consent", "m1", "o1", "set_owner", "o2", united))
+	checkError(t, s.invoke("set_owner", "m1", "o2", united), 500, "has 50 of 100 units")
+
+	checkOK(t, s.invoke("transfer_shares", "m1", "o3", "o1", "20", united))
+	checkOK(t, s.invoke("set_owner", "m1", "o2", united))
+	marble := s.stored(t, "m1")
+	if marble.Owner.Id != "o2" || marble.Shares != nil {
+		t.Fatalf("expected o2 to own all of m1, got %+v", marble)
+	}
+}
+
+func TestConsolidateAndDeleteNeedQuorum(t *testing.T) {
+	s := coOwnedMarble(t)
+	checkError(t, s.invoke("delete_marble", "m1", united), 500, "needs consent from 60%")
+	checkOK(t, s.invoke("consent", "m1", "o2", "consolidate", "o3", marbleInc))
+	checkOK(t, s.invoke("consent", "m1", "o3", "consolidate", "o3", united))
+	checkOK(t, s.invoke("consent", "m1", "o1", "delete_marble", "-", united))
+	checkError(t, s.invoke("consolidate", "m1", "o3", united), 500, "has 50 of 100 units")
+	checkError(t, s.invoke("delete_marble", "m1", united), 500, "has 50 of 100 units")
+
+	checkOK(t, s.invoke("consent", "m1", "o1", "consolidate", "o3", united))
+	checkOK(t, s.invoke("consolidate", "m1", "o3", united))
+	checkOwner(t, s, "m1", "o3")
+}
+
+func TestShareRefusals(t *testing.T) {
+	s := coOwnedMarble(t)
+	checkError(t, s.invoke("split_ownership", "m1", "60", "o1", "100", united), 500, "already co-owned")
+	checkError(t, s.invoke("transfer_shares", "m1", "o3", "o1", "21", united), 500, "holds 20 units")
+	checkError(t, s.invoke("transfer_shares", "m1", "o2", "o1", "10", united), 500, "cannot authorize transfers")
+	checkError(t, s.invoke("consent", "m1", "o1", "burn", "-", united), 500, "Action must be")
+	checkError(t, s.invoke("list_marble", "m1", "40", united), 500, "co-owned")
+
+	s.marble(t, "m2", "red", "o1", united)
+	checkError(t, s.invoke("split_ownership", "m2", "50", "o1", "100", united), 500, "between 51 and 100")
+}
+
+// ============================================================================================================================
+// Freezes - compliance stops a marble, or all of an owner's holdings, from moving, refused with status LOCKED
+// ============================================================================================================================
+func TestFreezeMarbleAndOwner(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	s.marble(t, "m2", "red", "o1", united)
+
+	s.compliance()
+	checkOK(t, s.invoke("freeze_marble", "m1", "suspected fraud", "case-1"))
+	checkError(t, s.invoke("set_owner", "m1", "o2", united), LOCKED, "is frozen under case 'case-1'")
+	checkError(t, s.invoke("delete_marble", "m1", united), LOCKED, "is frozen")
+	checkError(t, s.invoke("list_marble", "m1", "10", united), LOCKED, "is frozen")
+	checkOK(t, s.invoke("set_owner", "m2", "o2", united))
+
+	checkOK(t, s.invoke("freeze_owner", "o2", "sanctions", "case-2"))
+	checkError(t, s.invoke("set_owner", "m2", "o1", marbleInc), LOCKED, "The owner 'o2' is frozen")
+
+	checkOK(t, s.invoke("unfreeze_marble", "m1"))
+	checkOK(t, s.invoke("unfreeze_owner", "o2"))
+	checkOK(t, s.invoke("set_owner", "m1", "o2", united))
+	checkOK(t, s.invoke("set_owner", "m2", "o1", marbleInc))
+}
+
+func TestFreezeRefusals(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("freeze_marble", "m1", "suspected fraud", "case-1"), 500, "does not have the marbles role 'compliance'")
+	s.admin()
+	checkError(t, s.invoke("freeze_marble", "m1", "suspected fraud", "case-1"), 500, "does not have the marbles role 'compliance'")
+
+	s.compliance()
+	checkError(t, s.invoke("unfreeze_marble", "m1"), 500, "is not frozen")
+	checkError(t, s.invoke("freeze_marble", "m1", "", "case-1"), 500, "Reason must be")
+}
+
+// ============================================================================================================================
+// Lost and stolen - a reported marble can't move, recovery returns it to its rightful owner wherever it went
+// ============================================================================================================================
+func TestReportAndRecoverMarble(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	checkOK(t, s.invoke("report_marble", "m1", "lost", "o1", united))
+	checkError(t, s.invoke("set_owner", "m1", "o2", united), 500, "is reported lost")
+	checkError(t, s.invoke("report_marble", "m1", "stolen", "o1", united), 500, "already reported")
+
+	checkError(t, s.invoke("recover_marble", "m1", marbleInc), 500, "cannot authorize recovery")
+	checkOK(t, s.invoke("recover_marble", "m1", united))
+	checkOwner(t, s, "m1", "o1")
+	checkOK(t, s.invoke("set_owner", "m1", "o2", united))
+}
+
+func TestPastOwnerClaimNeedsCompliance(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.owner(t, "o3", "carol", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+	checkOK(t, s.invoke("set_owner", "m1", "o2", united))
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("report_marble", "m1", "stolen", "o1", united), 500, "past owner claims need compliance")
+
+	s.compliance()
+	checkError(t, s.invoke("report_marble", "m1", "stolen", "o3", united), 500, "never owned marble")
+	checkOK(t, s.invoke("report_marble", "m1", "stolen", "o1", united))
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("recover_marble", "m1", united), 500, "does not have the marbles role 'compliance'")
+	s.compliance()
+	checkOK(t, s.invoke("recover_marble", "m1", united))
+	checkOwner(t, s, "m1", "o1")
+}
+
+// ============================================================================================================================
+// Attribute schemas - init_marble validates attributes, only mutable ones can be updated later
+// ============================================================================================================================
+func TestMarbleAttributes(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united, "material=glass", "rarity=rare", "image_hash=aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	checkOK(t, s.invoke("update_marble_attributes", "m1", united, "rarity=legendary", "image_hash="))
+	checkError(t, s.invoke("update_marble_attributes", "m1", united, "material=clay"), 500, "can't be changed after creation")
+	checkError(t, s.invoke("update_marble_attributes", "m1", united, "rarity=mythic"), 500, "must be one of")
+	checkError(t, s.invoke("update_marble_attributes", "m1", marbleInc, "rarity=common"), 500, "cannot authorize changes")
+
+	attributes := s.stored(t, "m1").Attributes
+	if len(attributes) != 2 || attributes["material"] != "glass" || attributes["rarity"] != "legendary" {
+		t.Fatalf("unexpected attributes %v", attributes)
+	}
+}
+
+func TestAttributeSchemaRefusals(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.allow(t, united, "*", 10)
+	schema := `{"attributes": {"serial": {"type": "int", "required": true}}}`
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("set_attribute_schema", "marble", schema), 500, "does not have the marbles role")
+	s.admin()
+	checkError(t, s.invoke("set_attribute_schema", "marble", `{"attributes": {"serial": {"type": "float"}}}`), 500, "unknown type")
+	checkOK(t, s.invoke("set_attribute_schema", "marble", schema))
+
+	checkError(t, s.invoke("init_marble", "m1", "blue", "35", "o1", united), 500, "'serial' is required")
+	checkError(t, s.invoke("init_marble", "m1", "blue", "35", "o1", united, "serial=x1"), 500, "must be a numeric string")
+	checkError(t, s.invoke("init_marble", "m1", "blue", "35", "o1", united, "serial=1", "material=glass"), 500, "not in the marble schema")
+	s.marble(t, "m1", "blue", "o1", united, "serial=1")
+}
+
+// ============================================================================================================================
+// Certifications - appraisers certify marbles as themselves, and only revoke their own
+// ============================================================================================================================
+func TestIssueAndRevokeCertification(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	s.as(org1, "appraiser1", "marbles.role", "appraiser")
+	checkOK(t, s.invoke("issue_certification", "c1", "m1", "A+", "250", "365"))
+	checkOK(t, s.invoke("issue_certification", "c2", "m1", "A", "200", "30"))
+	checkError(t, s.invoke("issue_certification", "c1", "m1", "B", "100", "365"), 500, "already exists")
+
+	checkOK(t, s.invoke("set_owner", "m1", "o2", united))
+	checkCertificationIds(t, s.invoke("getCertifications", "m1"), "c1", "c2")
+
+	checkOK(t, s.invoke("revoke_certification", "m1", "c2"))
+	checkError(t, s.invoke("revoke_certification", "m1", "c2"), 500, "already revoked")
+	checkCertificationIds(t, s.invoke("getCertifications", "m1"), "c1")
+}
+
+func TestCertificationRefusals(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.allow(t, united, "*", 10)
+	s.marble(t, "m1", "blue", "o1", united)
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("issue_certification", "c1", "m1", "A+", "250", "365"), 500, "does not have the marbles role 'appraiser'")
+
+	s.as(org1, "appraiser1", "marbles.role", "appraiser")
+	checkOK(t, s.invoke("issue_certification", "c1", "m1", "A+", "250", "365"))
+	s.as(org2, "appraiser1", "marbles.role", "appraiser")
+	checkError(t, s.invoke("revoke_certification", "m1", "c1"), 500, "issued by another appraiser")
+	s.as(org1, "appraiser2", "marbles.role", "appraiser")
+	checkError(t, s.invoke("revoke_certification", "m1", "c1"), 500, "issued by another appraiser")
+	checkCertificationIds(t, s.invoke("getCertifications", "m1"), "c1")
+}
+
+// ============================================================================================================================
+// Minting - init_marble uses up the company's allowance, or stamps the next number of a limited edition
+// ============================================================================================================================
+func TestMintAllowance(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.allow(t, united, "*", 5)
+	s.allow(t, united, "blue", 1)
+
+	s.marble(t, "m1", "blue", "o1", united)
+	checkError(t, s.invoke("init_marble", "m2", "blue", "35", "o1", united), 500, "used up its mint allowance for 'blue'")
+	s.marble(t, "m2", "red", "o1", united)
+	checkError(t, s.invoke("init_marble", "m3", "red", "35", "o2", marbleInc), 500, "has no mint allowance")
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("set_mint_allowance", united, "blue", "100"), 500, "does not have the marbles role")
+}
+
+func TestLimitedEdition(t *testing.T) {
+	s := newTestStub()
+	s.owner(t, "o1", "alice", united)
+	s.owner(t, "o2", "bob", marbleInc)
+	s.admin()
+	checkOK(t, s.invoke("create_edition", "e1", united, "gold", "2"))
+	checkError(t, s.invoke("create_edition", "e1", united, "gold", "5"), 500, "already exists")
+
+	s.marble(t, "m1", "gold", "o1", united, "edition=e1")
+	s.marble(t, "m2", "gold", "o1", united, "edition=e1")
+	edition := s.stored(t, "m2").Edition
+	if edition == nil || edition.Id != "e1" || edition.Number != 2 || edition.Label != "2 of 2" {
+		t.Fatalf("unexpected edition stamp %+v", edition)
+	}
+
+	checkError(t, s.invoke("init_marble", "m3", "gold", "35", "o1", united, "edition=e1"), 500, "is sold out")
+	checkError(t, s.invoke("init_marble", "m3", "gold", "35", "o2", marbleInc, "edition=e1"), 500, "is for gold marbles of 'United Marbles'")
+	checkError(t, s.invoke("init_marble", "m3", "blue", "35", "o1", united, "edition=e1"), 500, "is for gold marbles")
+}
@@ -20,11 +20,24 @@ under the License.
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"unicode"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
 // ============================================================================================================================
@@ -45,6 +58,20 @@ func get_message(stub shim.ChaincodeStubInterface, id string) (Message, error) {
 	return message, nil
 }
 
+// ============================================================================================================================
+// Check Id Free - error if anything, a message, messenger or group, is already stored under the id
+// ============================================================================================================================
+func check_id_free(stub shim.ChaincodeStubInterface, id string) error {
+	valAsBytes, err := stub.GetState(id)
+	if err != nil {
+		return errors.New("Failed to get state - " + id)
+	}
+	if valAsBytes != nil {
+		return errors.New("This id already exists - " + id)
+	}
+	return nil
+}
+
 // ============================================================================================================================
 // Get Messenger - get the messenger asset from ledger
 // ============================================================================================================================
@@ -63,6 +90,1133 @@ func get_messenger(stub shim.ChaincodeStubInterface, id string) (Messenger, erro
 	return messenger, nil
 }
 
+// ============================================================================================================================
+// Get Acting Messenger - get the messenger a transaction acts as, it must belong to the caller's org
+// ============================================================================================================================
+func get_acting_messenger(stub shim.ChaincodeStubInterface, id string) (Messenger, error) {
+	messenger, err := get_messenger(stub, id)
+	if err != nil {
+		return messenger, err
+	}
+	return messenger, check_messenger_org(stub, messenger)
+}
+
+// ============================================================================================================================
+// Check Messenger Org - make sure a messenger belongs to the caller's org
+// ============================================================================================================================
+func check_messenger_org(stub shim.ChaincodeStubInterface, messenger Messenger) error {
+	caller_msp, err := get_creator_msp(stub)
+	if err != nil {
+		return err
+	}
+	if messenger.Company != caller_msp {
+		return errors.New("The org '" + caller_msp + "' cannot act for messenger '" + messenger.Id + "' of '" + messenger.Company + "'.")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Is Org Admin - test if the caller is an admin of an org, an msp member with the attribute messaging.org_admin=true
+// ============================================================================================================================
+func is_org_admin(stub shim.ChaincodeStubInterface, org string) bool {
+	caller_msp, err := get_creator_msp(stub)
+	if err != nil || caller_msp != org {
+		return false
+	}
+	org_admin, err := get_creator_attribute(stub, "messaging.org_admin")
+	return err == nil && org_admin == "true"
+}
+
+// ============================================================================================================================
+// Put Messenger - store the messenger asset
+// ============================================================================================================================
+func put_messenger(stub shim.ChaincodeStubInterface, messenger Messenger) error {
+	messengerAsBytes, _ := json.Marshal(messenger)             //convert to array of bytes
+	return stub.PutState(messenger.Id, messengerAsBytes)       //store messenger by its Id
+}
+
+// ============================================================================================================================
+// Accepts Messages From - test a messenger's block list and contact policy against a sender
+// ============================================================================================================================
+func accepts_messages_from(messenger Messenger, sender_id string) bool {
+	if contains(messenger.Blocked, sender_id) {
+		return false
+	}
+	if messenger.ContactPolicy == "allow_list" {
+		return contains(messenger.AllowList, sender_id)
+	}
+	return true
+}
+
+// ============================================================================================================================
+// Contains - test if a list of ids holds an id
+// ============================================================================================================================
+func contains(ids []string, id string) bool {
+	for _, val := range ids {
+		if val == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// Error Response - an error with a status code other than shim.Error()'s 500
+// ============================================================================================================================
+func error_response(status int32, message string) pb.Response {
+	return pb.Response{Status: status, Message: message}
+}
+
+// ============================================================================================================================
+// Get Group - get the group asset from ledger
+// ============================================================================================================================
+func get_group(stub shim.ChaincodeStubInterface, id string) (Group, error) {
+	var group Group
+	groupAsBytes, err := stub.GetState(id)                     //getState retreives a key/value from the ledger
+	if err != nil {
+		return group, errors.New("Failed to get group - " + id)
+	}
+	json.Unmarshal(groupAsBytes, &group)                       //un stringify it aka JSON.parse()
+
+	if group.ObjectType != "message_group" || group.Id != id { //test if group is actually here or just nil
+		return group, errors.New("Group does not exist - " + id)
+	}
+
+	return group, nil
+}
+
+// ============================================================================================================================
+// Is Group Admin - test if a messenger is one of a group's admins
+// ============================================================================================================================
+func is_group_admin(group Group, messenger_id string) bool {
+	for _, admin := range group.Admins {
+		if admin.Id == messenger_id {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// Group Member Key - composite key of a group's member, group~member
+// ============================================================================================================================
+func group_member_key(stub shim.ChaincodeStubInterface, group_id string, messenger_id string) (string, error) {
+	return stub.CreateCompositeKey("group~member", []string{group_id, messenger_id})
+}
+
+// ============================================================================================================================
+// Put Group Member - store a messenger under the group~member index
+// ============================================================================================================================
+func put_group_member(stub shim.ChaincodeStubInterface, group_id string, messenger Messenger) error {
+	var member MessengerRelation
+	member.Id = messenger.Id
+	member.Username = messenger.Username
+	member.Company = messenger.Company
+
+	memberKey, err := group_member_key(stub, group_id, member.Id)
+	if err != nil {
+		return err
+	}
+	memberAsBytes, _ := json.Marshal(member)                   //convert to array of bytes
+	return stub.PutState(memberKey, memberAsBytes)
+}
+
+// ============================================================================================================================
+// Get Group Members - get the current members of a group
+// ============================================================================================================================
+func get_group_members(stub shim.ChaincodeStubInterface, group_id string) ([]MessengerRelation, error) {
+	var members []MessengerRelation
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("group~member", []string{group_id})
+	if err != nil {
+		return members, errors.New("Failed to get members of group - " + group_id)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, memberAsBytes, err := resultsIterator.Next()
+		if err != nil {
+			return members, err
+		}
+
+		var member MessengerRelation
+		json.Unmarshal(memberAsBytes, &member)                 //un stringify it aka JSON.parse()
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// ============================================================================================================================
+// Message Recipients - ids of everyone whose inbox got a message, the group members for group messages
+// ============================================================================================================================
+func message_recipients(message Message) []string {
+	if message.ToGroup {
+		return message.DeliveredTo
+	}
+	return []string{message.Recipient.Id}
+}
+
+// ============================================================================================================================
+// Is Recipient - test if a messenger got a message in their inbox
+// ============================================================================================================================
+func is_recipient(message Message, messenger_id string) bool {
+	for _, recipient_id := range message_recipients(message) {
+		if recipient_id == messenger_id {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// Get Creator MSP - get the msp id of the identity that submitted this transaction
+// ============================================================================================================================
+func get_creator_msp(stub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := get_creator(stub)
+	if err != nil {
+		return "", err
+	}
+	return identity.Mspid, nil
+}
+
+// ============================================================================================================================
+// Get Creator - get the serialized identity (msp id + cert) that submitted this transaction
+// ============================================================================================================================
+func get_creator(stub shim.ChaincodeStubInterface) (msp.SerializedIdentity, error) {
+	var identity msp.SerializedIdentity
+	creatorAsBytes, err := stub.GetCreator()
+	if err != nil {
+		return identity, errors.New("Failed to get transaction creator")
+	}
+
+	err = proto.Unmarshal(creatorAsBytes, &identity)
+	if err != nil {
+		return identity, errors.New("Failed to parse transaction creator")
+	}
+	return identity, nil
+}
+
+// ============================================================================================================================
+// Get Creator Cert - get the enrollment cert of the identity that submitted this transaction
+// ============================================================================================================================
+func get_creator_cert(stub shim.ChaincodeStubInterface) (*x509.Certificate, error) {
+	identity, err := get_creator(stub)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return nil, errors.New("Failed to decode creator cert")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Failed to parse creator cert")
+	}
+	return cert, nil
+}
+
+// ============================================================================================================================
+// Get Creator Attribute - get an attribute the CA put in the creator's enrollment cert, "" if it isn't there
+// ============================================================================================================================
+func get_creator_attribute(stub shim.ChaincodeStubInterface, name string) (string, error) {
+	type Attributes struct {
+		Attrs map[string]string `json:"attrs"`
+	}
+	var attrs Attributes
+	attrOID := asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}   //extension fabric-ca stores attributes in
+
+	cert, err := get_creator_cert(stub)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(attrOID) {
+			json.Unmarshal(ext.Value, &attrs)                  //un stringify it aka JSON.parse()
+			return attrs.Attrs[name], nil
+		}
+	}
+	return "", nil
+}
+
+// ============================================================================================================================
+// Check Admin - make sure the caller's cert carries the attribute messaging.admin=true
+// ============================================================================================================================
+func check_admin(stub shim.ChaincodeStubInterface) error {
+	admin, err := get_creator_attribute(stub, "messaging.admin")
+	if err != nil {
+		return err
+	}
+	if admin != "true" {
+		return errors.New("Caller is not a messaging admin")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Collection Name - name of the private data collection shared by two orgs, see collections_config.json
+// ============================================================================================================================
+func collection_name(org_a string, org_b string) (string, []string) {
+	orgs := []string{org_a, org_b}
+	sort.Strings(orgs)                                         //same pair, same collection, regardless of direction
+	if orgs[0] == orgs[1] {
+		return "collection" + orgs[0], orgs[:1]
+	}
+	return "collection" + orgs[0] + orgs[1], orgs
+}
+
+// ============================================================================================================================
+// Hash Text - sha256 of a string, as hex
+// ============================================================================================================================
+func hash_text(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// ============================================================================================================================
+// Text Hash - sha256 of a message's salt and text, this is all the channel gets to see
+// ============================================================================================================================
+func text_hash(salt string, text string) string {
+	return hash_text(salt + ":" + text)                        //hex has no ":", so the split is unambiguous
+}
+
+// ============================================================================================================================
+// Check Collection Member - make sure the caller's org is one of the orgs of the message's collection
+// ============================================================================================================================
+func check_collection_member(stub shim.ChaincodeStubInterface, message Message) error {
+	caller_msp, err := get_creator_msp(stub)
+	if err != nil {
+		return err
+	}
+	for _, org := range message.Orgs {
+		if org == caller_msp {
+			return nil
+		}
+	}
+	return errors.New("The org '" + caller_msp + "' is not a member of collection '" + message.Collection + "'")
+}
+
+// ============================================================================================================================
+// Get Message Text - get a message's text from its private data collection
+// ============================================================================================================================
+func get_message_text(stub shim.ChaincodeStubInterface, message Message) (string, error) {
+	var body MessageBody
+	bodyAsBytes, err := stub.GetPrivateData(message.Collection, message.Id)
+	if err != nil {
+		return "", errors.New("Failed to get private text for message - " + message.Id)
+	}
+	json.Unmarshal(bodyAsBytes, &body)                         //un stringify it aka JSON.parse()
+
+	if body.Id != message.Id {                                 //this peer may not have the private data
+		return "", errors.New("Private text does not exist for message - " + message.Id)
+	}
+	if text_hash(body.Salt, body.Text) != message.TextHash {   //private data must match the hash on the channel
+		return "", errors.New("Private text does not match the ledger hash for message - " + message.Id)
+	}
+
+	return body.Text, nil
+}
+
+// ============================================================================================================================
+// Put Message Text - store a message's text in its private data collection
+// ============================================================================================================================
+func put_message_text(stub shim.ChaincodeStubInterface, message Message, text string, salt string) error {
+	var body MessageBody
+	body.ObjectType = "message_body"
+	body.Id = message.Id
+	body.Text = text
+	body.Salt = salt
+
+	bodyAsBytes, _ := json.Marshal(body)                       //convert to array of bytes
+	return stub.PutPrivateData(message.Collection, message.Id, bodyAsBytes)
+}
+
+// ============================================================================================================================
+// Revision Key - private data key a prior revision's text is kept under, message_revision~message~revision
+// ============================================================================================================================
+func revision_key(stub shim.ChaincodeStubInterface, message_id string, revision int) (string, error) {
+	return stub.CreateCompositeKey("message_revision", []string{message_id, strconv.Itoa(revision)})
+}
+
+// ============================================================================================================================
+// Get Revision Body - get a message's text and salt as they were at a revision, from the revision's or the current body
+// ============================================================================================================================
+func get_revision_body(stub shim.ChaincodeStubInterface, message Message, revision int) (MessageBody, error) {
+	var body MessageBody
+	key := message.Id
+	if revision != message.Revision {
+		var err error
+		key, err = revision_key(stub, message.Id, revision)
+		if err != nil {
+			return body, err
+		}
+	}
+	bodyAsBytes, err := stub.GetPrivateData(message.Collection, key)
+	if err != nil {
+		return body, errors.New("Failed to get private text for revision " + strconv.Itoa(revision) + " of message - " + message.Id)
+	}
+	json.Unmarshal(bodyAsBytes, &body)                         //un stringify it aka JSON.parse()
+
+	if body.Id != message.Id {                                 //this peer may not have the private data
+		return body, errors.New("Private text does not exist for revision " + strconv.Itoa(revision) + " of message - " + message.Id)
+	}
+	return body, nil
+}
+
+// ============================================================================================================================
+// Get Transient Text - message text and its salt are passed in the transient map so they never land in the transaction
+//
+// The salt must be at least 16 random bytes from the client, chaincode can't make randomness every endorser agrees on
+// ============================================================================================================================
+func get_transient_text(stub shim.ChaincodeStubInterface) (string, string, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return "", "", errors.New("Failed to get transient map")
+	}
+
+	text, ok := transient["text"]
+	if !ok || len(text) == 0 {
+		return "", "", errors.New("Message text must be passed in the transient map under 'text'")
+	}
+	salt, ok := transient["salt"]
+	if !ok || len(salt) < 16 {
+		return "", "", errors.New("A random salt of at least 16 bytes must be passed in the transient map under 'salt'")
+	}
+	return string(text), hex.EncodeToString(salt), nil
+}
+
+// ============================================================================================================================
+// Conversation Id - the conversation of two messengers, the same id whoever sends, or a group's id
+//
+// a group id never holds ':' so it can't collide with a pair of messenger ids, see check_conversation_party_id()
+// ============================================================================================================================
+func conversation_id(sender_id string, recipient_id string, to_group bool) string {
+	if to_group {
+		return recipient_id
+	}
+	ids := []string{sender_id, recipient_id}
+	sort.Strings(ids)
+	return ids[0] + ":" + ids[1]
+}
+
+// ============================================================================================================================
+// Check Conversation Party Id - messenger and group ids can't hold ':', else two conversations could get the same id
+// ============================================================================================================================
+func check_conversation_party_id(id string) error {
+	if strings.Contains(id, ":") {
+		return errors.New("Id cannot contain ':' - " + id)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Chain Hash - hash linking a message to the previous one in its conversation, only covers fields that never change
+// so the chain can be recomputed from the ledger, or from an export, at any time
+// ============================================================================================================================
+func chain_hash(message Message) string {
+	return hash_text(strings.Join([]string{
+		message.Conversation,
+		strconv.Itoa(message.Seq),
+		message.Id,
+		message.Sender.Id,
+		message.Recipient.Id,
+		strconv.FormatInt(message.SentAt, 10),
+		message.ContentHash,
+		message.PrevHash,
+	}, "|"))
+}
+
+// ============================================================================================================================
+// Get Conversation Head - get the last link of a conversation, an empty head if it has no messages yet
+// ============================================================================================================================
+func get_conversation_head(stub shim.ChaincodeStubInterface, conversation string) (ConversationHead, error) {
+	var head ConversationHead
+	key, err := stub.CreateCompositeKey("conversation_head", []string{conversation})
+	if err != nil {
+		return head, err
+	}
+	headAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return head, errors.New("Failed to get conversation - " + conversation)
+	}
+	json.Unmarshal(headAsBytes, &head)                         //un stringify it aka JSON.parse()
+
+	head.ObjectType = "conversation_head"
+	head.Conversation = conversation
+	return head, nil
+}
+
+// ============================================================================================================================
+// Chain Message - link a new message to the end of its conversation, and index it under conversation~seq~message
+// ============================================================================================================================
+func chain_message(stub shim.ChaincodeStubInterface, message *Message) error {
+	message.Conversation = conversation_id(message.Sender.Id, message.Recipient.Id, message.ToGroup)
+	head, err := get_conversation_head(stub, message.Conversation)
+	if err != nil {
+		return err
+	}
+
+	message.Seq = head.Seq + 1
+	message.ContentHash = message.TextHash
+	message.PrevHash = head.Hash
+	message.Hash = chain_hash(*message)
+
+	head.Seq = message.Seq
+	head.MessageId = message.Id
+	head.Hash = message.Hash
+	headKey, err := stub.CreateCompositeKey("conversation_head", []string{head.Conversation})
+	if err != nil {
+		return err
+	}
+	headAsBytes, _ := json.Marshal(head)                       //convert to array of bytes
+	err = stub.PutState(headKey, headAsBytes)
+	if err != nil {
+		return err
+	}
+
+	// the index outlives the message, so verifyConversation can tell a removed message from a missing link
+	indexKey, err := stub.CreateCompositeKey("conversation~message", []string{message.Conversation, fmt.Sprintf("%010d", message.Seq), message.Id})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(indexKey, []byte{0x00})               //the key is the index, value is unused
+}
+
+// ============================================================================================================================
+// Get Tx Time - the transaction timestamp in unix seconds, the same on every endorsing peer unlike the wall clock
+// ============================================================================================================================
+func get_tx_time(stub shim.ChaincodeStubInterface) (int64, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return 0, errors.New("Failed to get transaction timestamp")
+	}
+	return timestamp.Seconds, nil
+}
+
+// ============================================================================================================================
+// Get Config - get the messaging config document, an empty config if it was never set
+// ============================================================================================================================
+func get_config(stub shim.ChaincodeStubInterface) (MessagingConfig, error) {
+	var config MessagingConfig
+	configAsBytes, err := stub.GetState("messaging_config")
+	if err != nil {
+		return config, errors.New("Failed to get messaging config")
+	}
+	json.Unmarshal(configAsBytes, &config)                     //un stringify it aka JSON.parse()
+
+	config.ObjectType = "messaging_config"
+	if config.PrioritySLA == nil {
+		config.PrioritySLA = map[string]int64{}
+	}
+	if config.Retention == nil {
+		config.Retention = map[string]int64{}
+	}
+	if config.RateLimits == nil {
+		config.RateLimits = map[string]RateLimit{}
+	}
+	return config, nil
+}
+
+// ============================================================================================================================
+// Put Config - store the messaging config document
+// ============================================================================================================================
+func put_config(stub shim.ChaincodeStubInterface, config MessagingConfig) error {
+	configAsBytes, _ := json.Marshal(config)                   //convert to array of bytes
+	return stub.PutState("messaging_config", configAsBytes)
+}
+
+// ============================================================================================================================
+// Is Expired - a message with an expiry in the past is treated as gone, even before it is swept
+// ============================================================================================================================
+func is_expired(message Message, now int64) bool {
+	return message.ExpiresAt != 0 && message.ExpiresAt <= now
+}
+
+// ============================================================================================================================
+// Is Expired Record - test a raw state value, true only if it is a message that has expired
+// ============================================================================================================================
+func is_expired_record(valAsBytes []byte, now int64) bool {
+	var message Message
+	json.Unmarshal(valAsBytes, &message)                       //un stringify it aka JSON.parse()
+	return message.ObjectType == "message" && is_expired(message, now)
+}
+
+// ============================================================================================================================
+// Is Pending - a scheduled message is pending, and hidden from its recipients, until its deliver at time
+// ============================================================================================================================
+func is_pending(message Message, now int64) bool {
+	return message.DeliverAt > now
+}
+
+// ============================================================================================================================
+// Delivered At - when a message showed up in its recipients' inboxes
+// ============================================================================================================================
+func delivered_at(message Message) int64 {
+	if message.DeliverAt > message.SentAt {
+		return message.DeliverAt
+	}
+	return message.SentAt
+}
+
+// ============================================================================================================================
+// Get Live Message - get a message asset from ledger, unless it has expired
+// ============================================================================================================================
+func get_live_message(stub shim.ChaincodeStubInterface, id string) (Message, error) {
+	message, err := get_message(stub, id)
+	if err != nil {
+		return message, err
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return message, err
+	}
+	if is_expired(message, now) {
+		return message, errors.New("Message does not exist - " + id)
+	}
+	return message, nil
+}
+
+// ============================================================================================================================
+// Remove Message - remove a message, its private texts, its search terms, its inbox/outbox indexes and its receipts
+// ============================================================================================================================
+func remove_message(stub shim.ChaincodeStubInterface, message Message) error {
+	text, err := get_message_text(stub, message)
+	if err == nil {                                            //without the text, searchMessages skips the stale entries
+		secret, err := get_search_secret(stub, message.Collection, "")
+		if err == nil {
+			err = index_message_terms(stub, secret, message.Id, text, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = stub.DelState(message.Id)                            //remove the key from chaincode state
+	if err != nil {
+		return errors.New("Failed to delete state")
+	}
+
+	err = stub.DelPrivateData(message.Collection, message.Id)  //remove its text from the private collection
+	if err != nil {
+		return errors.New("Failed to delete private text")
+	}
+	for revision := 0; revision < message.Revision; revision++ {   //and the text of every prior revision
+		key, err := revision_key(stub, message.Id, revision)
+		if err != nil {
+			return err
+		}
+		err = stub.DelPrivateData(message.Collection, key)
+		if err != nil {
+			return errors.New("Failed to delete private text")
+		}
+	}
+
+	outboxKey, err := outbox_key(stub, message.Sender.Id, message.Id)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(outboxKey)
+	if err != nil {
+		return errors.New("Failed to delete outbox index")
+	}
+
+	if message.ExpiresAt != 0 {
+		expiryKey, err := expiry_key(stub, message.ExpiresAt, message.Id)
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(expiryKey)
+		if err != nil {
+			return errors.New("Failed to delete expiry index")
+		}
+	}
+
+	for _, recipient_id := range message_recipients(message) {
+		inboxKey, err := inbox_key(stub, recipient_id, message.Id)
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(inboxKey)
+		if err != nil {
+			return errors.New("Failed to delete inbox index")
+		}
+
+		receiptKey, err := receipt_key(stub, message.Id, recipient_id)
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(receiptKey)
+		if err != nil {
+			return errors.New("Failed to delete receipt")
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Inbox Key - composite key indexing a message under its recipient, inbox~messenger~message
+// ============================================================================================================================
+func inbox_key(stub shim.ChaincodeStubInterface, messenger_id string, message_id string) (string, error) {
+	return stub.CreateCompositeKey("inbox~message", []string{messenger_id, message_id})
+}
+
+// ============================================================================================================================
+// Expiry Key - composite key indexing a message by when it expires, expiry~expires at~message
+//
+// The time is zero padded so keys sort oldest first, see sweep_expired()
+// ============================================================================================================================
+func expiry_key(stub shim.ChaincodeStubInterface, expires_at int64, message_id string) (string, error) {
+	return stub.CreateCompositeKey("expiry~message", []string{fmt.Sprintf("%020d", expires_at), message_id})
+}
+
+// ============================================================================================================================
+// Outbox Key - composite key indexing a message under its sender, outbox~messenger~message
+// ============================================================================================================================
+func outbox_key(stub shim.ChaincodeStubInterface, messenger_id string, message_id string) (string, error) {
+	return stub.CreateCompositeKey("outbox~message", []string{messenger_id, message_id})
+}
+
+// ============================================================================================================================
+// Put Tombstone - leave a tombstone saying why a removed message is gone
+// ============================================================================================================================
+func put_tombstone(stub shim.ChaincodeStubInterface, message Message, reason string, now int64) error {
+	var tombstone Tombstone
+	tombstone.ObjectType = "message_tombstone"
+	tombstone.MessageId = message.Id
+	tombstone.Reason = reason
+	tombstone.ExpiresAt = message.ExpiresAt
+	tombstone.RemovedAt = now
+	tombstone.TxId = stub.GetTxID()
+
+	tombstoneKey, err := stub.CreateCompositeKey("tombstone", []string{message.Id})
+	if err != nil {
+		return err
+	}
+	tombstoneAsBytes, _ := json.Marshal(tombstone)             //convert to array of bytes
+	return stub.PutState(tombstoneKey, tombstoneAsBytes)
+}
+
+// ============================================================================================================================
+// Get Outbox - get all messages indexed under a messenger's outbox, including expired ones
+// ============================================================================================================================
+func get_outbox(stub shim.ChaincodeStubInterface, messenger_id string) ([]Message, error) {
+	var messages []Message
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("outbox~message", []string{messenger_id})
+	if err != nil {
+		return messages, errors.New("Failed to get outbox for messenger - " + messenger_id)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		indexKey, _, err := resultsIterator.Next()
+		if err != nil {
+			return messages, err
+		}
+
+		_, keyParts, err := stub.SplitCompositeKey(indexKey)
+		if err != nil {
+			return messages, err
+		}
+
+		message, err := get_message(stub, keyParts[1])         //the index holds no value, the message is the real record
+		if err != nil {
+			continue                                           //stale index entry, message is gone
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// ============================================================================================================================
+// Get Inbox - get all delivered messages indexed under a messenger's inbox
+// ============================================================================================================================
+func get_inbox(stub shim.ChaincodeStubInterface, messenger_id string) ([]Message, error) {
+	var messages []Message
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return messages, err
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("inbox~message", []string{messenger_id})
+	if err != nil {
+		return messages, errors.New("Failed to get inbox for messenger - " + messenger_id)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		indexKey, _, err := resultsIterator.Next()
+		if err != nil {
+			return messages, err
+		}
+
+		_, keyParts, err := stub.SplitCompositeKey(indexKey)
+		if err != nil {
+			return messages, err
+		}
+
+		message, err := get_message(stub, keyParts[1])         //the index holds no value, the message is the real record
+		if err != nil || is_expired(message, now) {
+			continue                                           //stale index entry, message is gone
+		}
+		if is_pending(message, now) || message.Hidden {
+			continue                                           //scheduled and not delivered yet, or hidden by a moderator
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// ============================================================================================================================
+// Tokenize - split text into its normalized search terms, lower case letters and digits, deduped and sorted
+// ============================================================================================================================
+func tokenize(text string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if len([]rune(word)) < 2 || seen[word] {               //single characters are too common to be worth indexing
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// ============================================================================================================================
+// Get Search Secret - get the collection's secret the search index is keyed with, made from the salt if it has none yet
+//
+// The secret lives in the collection's private data, so only the collection's orgs can compute or test index keys. the
+// first message's salt is random and private, which makes a secret every endorser agrees on without chaincode randomness
+// ============================================================================================================================
+func get_search_secret(stub shim.ChaincodeStubInterface, collection string, salt string) (string, error) {
+	secretAsBytes, err := stub.GetPrivateData(collection, "search_secret")
+	if err != nil {
+		return "", errors.New("Failed to get search secret of collection - " + collection)
+	}
+	if len(secretAsBytes) > 0 {
+		return string(secretAsBytes), nil
+	}
+	if salt == "" {
+		return "", errors.New("Search secret does not exist for collection - " + collection)
+	}
+
+	secret := hash_text("search_secret:" + salt)
+	err = stub.PutPrivateData(collection, "search_secret", []byte(secret))
+	if err != nil {
+		return "", errors.New("Failed to store search secret of collection - " + collection)
+	}
+	return secret, nil
+}
+
+// ============================================================================================================================
+// Term Key - composite key of the inverted index, term~message
+// the term is an hmac keyed by the collection's search secret, so the index can't be reversed by hashing a dictionary
+// ============================================================================================================================
+func term_key(stub shim.ChaincodeStubInterface, secret string, term string, message_id string) (string, error) {
+	return stub.CreateCompositeKey("term~message", []string{term_mac(secret, term), message_id})
+}
+
+// ============================================================================================================================
+// Term Mac - hmac-sha256 of a search term, as hex
+// ============================================================================================================================
+func term_mac(secret string, term string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(term))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ============================================================================================================================
+// Index Message Terms - add (or with remove, drop) a message's text to the term~message index
+// ============================================================================================================================
+func index_message_terms(stub shim.ChaincodeStubInterface, secret string, message_id string, text string, remove bool) error {
+	for _, term := range tokenize(text) {
+		termKey, err := term_key(stub, secret, term, message_id)
+		if err != nil {
+			return err
+		}
+		if remove {
+			err = stub.DelState(termKey)
+		} else {
+			err = stub.PutState(termKey, []byte{0x00})         //the key is the index, value is unused
+		}
+		if err != nil {
+			return errors.New("Failed to update search index for message - " + message_id)
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Term Messages - ids of the messages of a collection indexed under a term
+// ============================================================================================================================
+func get_term_messages(stub shim.ChaincodeStubInterface, secret string, term string) (map[string]bool, error) {
+	ids := map[string]bool{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("term~message", []string{term_mac(secret, term)})
+	if err != nil {
+		return ids, errors.New("Failed to search for term - " + term)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		indexKey, _, err := resultsIterator.Next()
+		if err != nil {
+			return ids, err
+		}
+		_, keyParts, err := stub.SplitCompositeKey(indexKey)
+		if err != nil {
+			return ids, err
+		}
+		ids[keyParts[1]] = true
+	}
+	return ids, nil
+}
+
+// ============================================================================================================================
+// Count Send - count a send against the sender's rate limit, error if it is used up for the current window
+//
+// the counter is split over a fixed set of shard keys send_count~messenger~shard. a send adds to the one shard its tx id
+// picks, so the writes of concurrent sends are spread out, but the limit is checked against the sum of all shards that
+// are in the current window. a shard from an older window counts as 0 and is overwritten when picked
+// ============================================================================================================================
+func count_send(stub shim.ChaincodeStubInterface, config MessagingConfig, messenger_id string, now int64) error {
+	limit, ok := config.RateLimits[messenger_id]
+	if !ok {
+		limit = config.RateLimit
+	}
+	if limit.Count <= 0 || limit.Window <= 0 {                 //no limit
+		return nil
+	}
+
+	window := now - now % limit.Window                         //start of the current window
+	txHash := sha256.Sum256([]byte(stub.GetTxID()))
+	shard := int(txHash[0]) % SEND_COUNT_SHARDS
+
+	// total the sends of this window over all shards
+	var picked SendCount
+	var pickedKey string
+	total := 0
+	for i := 0; i < SEND_COUNT_SHARDS; i++ {
+		countKey, err := stub.CreateCompositeKey("send_count", []string{messenger_id, strconv.Itoa(i)})
+		if err != nil {
+			return err
+		}
+		countAsBytes, err := stub.GetState(countKey)
+		if err != nil {
+			return errors.New("Failed to get send count for messenger - " + messenger_id)
+		}
+		var count SendCount
+		json.Unmarshal(countAsBytes, &count)                   //un stringify it aka JSON.parse()
+		if count.Window != window {
+			count = SendCount{Window: window}                  //stale window, start over
+		}
+		total += count.Count
+		if i == shard {
+			picked = count
+			pickedKey = countKey
+		}
+	}
+	if total >= limit.Count {
+		return errors.New("The messenger '" + messenger_id + "' used up its sends for the current " + strconv.FormatInt(limit.Window, 10) + " second window, try again.")
+	}
+
+	picked.Count++
+	countAsBytes, _ := json.Marshal(picked)                    //convert to array of bytes
+	return stub.PutState(pickedKey, countAsBytes)
+}
+
+// ============================================================================================================================
+// Get Receipts - get every recipient's receipt for a message
+// ============================================================================================================================
+func get_receipts(stub shim.ChaincodeStubInterface, message_id string) ([]Receipt, error) {
+	var receipts []Receipt
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("receipt", []string{message_id})
+	if err != nil {
+		return receipts, errors.New("Failed to get receipts - " + message_id)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, receiptAsBytes, err := resultsIterator.Next()
+		if err != nil {
+			return receipts, err
+		}
+
+		var receipt Receipt
+		json.Unmarshal(receiptAsBytes, &receipt)               //un stringify it aka JSON.parse()
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+// ============================================================================================================================
+// Receipt Key - composite key of a recipient's receipt for a message, receipt~message~messenger
+// ============================================================================================================================
+func receipt_key(stub shim.ChaincodeStubInterface, message_id string, messenger_id string) (string, error) {
+	return stub.CreateCompositeKey("receipt", []string{message_id, messenger_id})
+}
+
+// ============================================================================================================================
+// Get Receipt - get a recipient's receipt for a message
+// ============================================================================================================================
+func get_receipt(stub shim.ChaincodeStubInterface, message_id string, messenger_id string) (Receipt, error) {
+	var receipt Receipt
+	key, err := receipt_key(stub, message_id, messenger_id)
+	if err != nil {
+		return receipt, err
+	}
+
+	receiptAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return receipt, errors.New("Failed to get receipt - " + message_id)
+	}
+	json.Unmarshal(receiptAsBytes, &receipt)                   //un stringify it aka JSON.parse()
+
+	if receipt.MessageId != message_id {                       //test if receipt is actually here or just nil
+		return receipt, errors.New("Receipt does not exist - " + message_id + ", '" + messenger_id + "'")
+	}
+	return receipt, nil
+}
+
+// ============================================================================================================================
+// Get Marble Ref - snapshot a marble's current version and owner, read from the marbles chaincode
+// the ref's Id is empty if the marble does not exist (anymore)
+//
+// Shows off InvokeChaincode() - the marbles getHistory query gives us the marble and the last tx that wrote it
+// ============================================================================================================================
+func get_marble_ref(stub shim.ChaincodeStubInterface, marble_id string) (MarbleRef, error) {
+	type MarbleHistory struct {
+		TxId    string   `json:"txId"`
+		Value   struct {
+			Id     string              `json:"id"`
+			Owner  MarbleOwnerRelation `json:"owner"`
+		} `json:"value"`
+	}
+	var history []MarbleHistory
+	var ref MarbleRef
+
+	args := [][]byte{[]byte("getHistory"), []byte(marble_id)}
+	response := stub.InvokeChaincode(marbles_chaincode, args, "")   //"" is this channel
+	if response.Status != shim.OK {
+		return ref, errors.New("Failed to get marble from chaincode '" + marbles_chaincode + "' - " + response.Message)
+	}
+	json.Unmarshal(response.Payload, &history)                 //un stringify it aka JSON.parse()
+
+	if len(history) == 0 || history[len(history)-1].Value.Id != marble_id {   //never existed, or last write deleted it
+		return ref, nil
+	}
+
+	current := history[len(history)-1]
+	ref.Id = marble_id
+	ref.TxId = current.TxId
+	ref.Owner = current.Value.Owner
+	return ref, nil
+}
+
+// ============================================================================================================================
+// Put Receipt - store a recipient's receipt for a message
+// ============================================================================================================================
+func put_receipt(stub shim.ChaincodeStubInterface, receipt Receipt) error {
+	receiptKey, err := receipt_key(stub, receipt.MessageId, receipt.Messenger.Id)
+	if err != nil {
+		return err
+	}
+	receiptAsBytes, _ := json.Marshal(receipt)                 //convert to array of bytes
+	return stub.PutState(receiptKey, receiptAsBytes)
+}
+
+// ============================================================================================================================
+// Set Message Event - set the chaincode event of this transaction, "message.<action>.<notify id>"
+//
+// notify id is who the event is for, listeners filter on their own id (or their groups' ids). the payload never has the
+// text. fabric keeps one event per transaction, the last one set wins
+// ============================================================================================================================
+func set_message_event(stub shim.ChaincodeStubInterface, action string, message Message, notify_id string) error {
+	var event MessageEvent
+	event.Action = action
+	event.MessageId = message.Id
+	event.Sender = message.Sender
+	event.Recipient = message.Recipient
+	event.Priority = message.Priority
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return err
+	}
+	event.Timestamp = now
+
+	eventAsBytes, _ := json.Marshal(event)                     //convert to array of bytes
+	return stub.SetEvent("message." + action + "." + notify_id, eventAsBytes)
+}
+
+// ============================================================================================================================
+// Get Report - get a report from ledger
+// ============================================================================================================================
+func get_report(stub shim.ChaincodeStubInterface, id string) (Report, error) {
+	var report Report
+	key, err := stub.CreateCompositeKey("report", []string{id})
+	if err != nil {
+		return report, err
+	}
+	reportAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return report, errors.New("Failed to get report - " + id)
+	}
+	json.Unmarshal(reportAsBytes, &report)                     //un stringify it aka JSON.parse()
+
+	if report.Id != id {                                       //test if report is actually here or just nil
+		return report, errors.New("Report does not exist - " + id)
+	}
+	return report, nil
+}
+
+// ============================================================================================================================
+// Put Report - store a report
+// ============================================================================================================================
+func put_report(stub shim.ChaincodeStubInterface, report Report) error {
+	key, err := stub.CreateCompositeKey("report", []string{report.Id})
+	if err != nil {
+		return err
+	}
+	reportAsBytes, _ := json.Marshal(report)                   //convert to array of bytes
+	return stub.PutState(key, reportAsBytes)
+}
+
+// ============================================================================================================================
+// Put Moderation Action - store a moderation action as its own asset, who did what to which report and why
+// ============================================================================================================================
+func put_moderation_action(stub shim.ChaincodeStubInterface, action string, report Report, reason string, now int64) error {
+	var moderation ModerationAction
+	moderation.ObjectType = "moderation_action"
+	moderation.TxId = stub.GetTxID()
+	moderation.Action = action
+	moderation.MessageId = report.MessageId
+	moderation.ReportId = report.Id
+	moderation.Reason = reason
+	moderation.At = now
+
+	identity, err := get_creator(stub)
+	if err != nil {
+		return err
+	}
+	cert, err := get_creator_cert(stub)
+	if err != nil {
+		return err
+	}
+	moderation.ByOrg = identity.Mspid
+	moderation.By = cert.Subject.CommonName
+
+	key, err := stub.CreateCompositeKey("moderation_action", []string{moderation.MessageId, moderation.TxId})
+	if err != nil {
+		return err
+	}
+	moderationAsBytes, _ := json.Marshal(moderation)           //convert to array of bytes
+	return stub.PutState(key, moderationAsBytes)
+}
+
 // ========================================================
 // Input Sanitation - dumb input checking, look for empty strings
 // ========================================================
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Test Stub - a MockStub plus what MockStub leaves out, the creator, transient map, tx time, private data, key history
+// and events. a failed invoke rolls its writes back, like a peer that never commits the transaction
+// ============================================================================================================================
+type testStub struct {
+	*shim.MockStub
+	cc        *SimpleChaincode
+	args      []string
+	txn       int
+	now       int64
+	creator   []byte
+	transient map[string][]byte
+	private   map[string]map[string][]byte
+	history   map[string][]historyEntry
+	events    []pb.ChaincodeEvent
+	invoked   func(name string, args [][]byte) pb.Response
+}
+
+type historyEntry struct {
+	txId  string
+	value []byte
+}
+
+func newTestStub() *testStub {
+	cc := new(SimpleChaincode)
+	return &testStub{
+		MockStub: shim.NewMockStub("messaging", cc),
+		cc:       cc,
+		now:      1500000000,
+		private:  map[string]map[string][]byte{},
+		history:  map[string][]historyEntry{},
+	}
+}
+
+// invoke - run one transaction through the chaincode's Invoke(), as the current creator at the current time
+func (s *testStub) invoke(function string, args ...string) pb.Response {
+	s.txn++
+	txId := "tx" + strconv.Itoa(s.txn)
+	state, keys, private, history, events := s.snapshot()
+
+	s.args = append([]string{function}, args...)
+	s.MockTransactionStart(txId)
+	res := s.cc.Invoke(s)
+	s.MockTransactionEnd(txId)
+	s.transient = nil
+
+	if res.Status >= shim.ERRORTHRESHOLD {
+		s.MockStub.State, s.MockStub.Keys, s.private, s.history, s.events = state, keys, private, history, events
+	}
+	return res
+}
+
+func (s *testStub) snapshot() (map[string][]byte, *list.List, map[string]map[string][]byte, map[string][]historyEntry, []pb.ChaincodeEvent) {
+	state := map[string][]byte{}
+	var sorted []string
+	for key, value := range s.MockStub.State {
+		state[key] = value
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	keys := list.New()
+	for _, key := range sorted {
+		keys.PushBack(key)
+	}
+	private := map[string]map[string][]byte{}
+	for collection, values := range s.private {
+		private[collection] = map[string][]byte{}
+		for key, value := range values {
+			private[collection][key] = value
+		}
+	}
+	history := map[string][]historyEntry{}
+	for key, entries := range s.history {
+		history[key] = entries
+	}
+	return state, keys, private, history, s.events
+}
+
+// as - submit the next transactions with a cert from an org, attrs are name/value pairs the CA puts in the cert
+func (s *testStub) as(mspId string, name string, attrs ...string) {
+	s.creator = newIdentity(mspId, name, attrs...)
+}
+
+// ----- ChaincodeStubInterface ----- //
+func (s *testStub) GetArgs() [][]byte {
+	var args [][]byte
+	for _, arg := range s.args {
+		args = append(args, []byte(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	return s.args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	return s.args[0], s.args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.now}, nil
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	s.history[key] = append(s.history[key], historyEntry{txId: s.GetTxID(), value: value})
+	return s.MockStub.PutState(key, value)
+}
+
+func (s *testStub) DelState(key string) error {
+	s.history[key] = append(s.history[key], historyEntry{txId: s.GetTxID()})
+	return s.MockStub.DelState(key)
+}
+
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{entries: s.history[key]}, nil
+}
+
+func (s *testStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return s.private[collection][key], nil
+}
+
+func (s *testStub) PutPrivateData(collection string, key string, value []byte) error {
+	if s.private[collection] == nil {
+		s.private[collection] = map[string][]byte{}
+	}
+	s.private[collection][key] = value
+	return nil
+}
+
+func (s *testStub) DelPrivateData(collection string, key string) error {
+	delete(s.private[collection], key)
+	return nil
+}
+
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	s.events = append(s.events, pb.ChaincodeEvent{EventName: name, Payload: payload})
+	return nil
+}
+
+func (s *testStub) InvokeChaincode(name string, args [][]byte, channel string) pb.Response {
+	if s.invoked == nil {
+		return shim.Error("Chaincode not found - " + name)
+	}
+	return s.invoked(name, args)
+}
+
+type historyIterator struct {
+	entries []historyEntry
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.entries) > 0
+}
+
+func (it *historyIterator) Next() (string, []byte, error) {
+	if len(it.entries) == 0 {
+		return "", nil, errors.New("No more history")
+	}
+	entry := it.entries[0]
+	it.entries = it.entries[1:]
+	return entry.txId, entry.value, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+// ============================================================================================================================
+// New Identity - a serialized identity with a self signed cert, carrying attributes the way fabric-ca does
+// ============================================================================================================================
+var testKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+func newIdentity(mspId string, name string, attrs ...string) []byte {
+	values := map[string]string{}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		values[attrs[i]] = attrs[i+1]
+	}
+	attrsAsBytes, _ := json.Marshal(map[string]map[string]string{"attrs": values})
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{mspId}},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(1<<32, 0),
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: attrsAsBytes},
+		},
+	}
+	certAsBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &testKey.PublicKey, testKey)
+	if err != nil {
+		panic(err)
+	}
+	identity := &msp.SerializedIdentity{
+		Mspid:   mspId,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certAsBytes}),
+	}
+	identityAsBytes, err := proto.Marshal(identity)
+	if err != nil {
+		panic(err)
+	}
+	return identityAsBytes
+}
+
+// ============================================================================================================================
+// Messaging fixtures
+// ============================================================================================================================
+const (
+	org1 = "Org1MSP"
+	org2 = "Org2MSP"
+	org3 = "Org3MSP"
+)
+
+// messenger - create a messenger as a member of an org
+func (s *testStub) messenger(t *testing.T, org string, id string, username string) {
+	t.Helper()
+	s.as(org, username)
+	checkOK(t, s.invoke("init_messenger", id, username))
+}
+
+// admin - act as a messaging admin of an org
+func (s *testStub) admin(org string) {
+	s.as(org, "admin", "messaging.admin", "true")
+}
+
+// send - send a message as a member of an org, args after the recipient are init_message()'s optional args
+func (s *testStub) send(org string, id string, sender_id string, recipient_id string, text string, args ...string) pb.Response {
+	s.as(org, sender_id)
+	s.transient = map[string][]byte{"text": []byte(text), "salt": []byte("salt-of-" + id + "-0123456789")}
+	return s.invoke("init_message", append([]string{id, "1", sender_id, recipient_id}, args...)...)
+}
+
+// message - the message as stored on the channel
+func (s *testStub) message(t *testing.T, id string) Message {
+	t.Helper()
+	var message Message
+	err := json.Unmarshal(s.MockStub.State[id], &message)
+	if err != nil {
+		t.Fatalf("message %s is not on the ledger", id)
+	}
+	return message
+}
+
+// marblesChaincode - stands in for the marbles chaincode's getHistory, marble id -> history json
+func marblesChaincode(histories map[string]string) func(string, [][]byte) pb.Response {
+	return func(name string, args [][]byte) pb.Response {
+		if name != "marbles" || string(args[0]) != "getHistory" {
+			return shim.Error("Unexpected call")
+		}
+		return shim.Success([]byte(histories[string(args[1])]))
+	}
+}
+
+// messageIds - the ids of a json array of messages, in order
+func messageIds(t *testing.T, res pb.Response) []string {
+	t.Helper()
+	checkOK(t, res)
+	var messages []Message
+	json.Unmarshal(res.Payload, &messages)
+	ids := []string{}
+	for _, message := range messages {
+		ids = append(ids, message.Id)
+	}
+	return ids
+}
+
+func checkIds(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func checkOK(t *testing.T, res pb.Response) {
+	t.Helper()
+	if res.Status != shim.OK {
+		t.Fatalf("expected success, got %d - %s", res.Status, res.Message)
+	}
+}
+
+func checkError(t *testing.T, res pb.Response, status int32, text string) {
+	t.Helper()
+	if res.Status != status || !strings.Contains(res.Message, text) {
+		t.Fatalf("expected %d with '%s', got %d - %s", status, text, res.Status, res.Message)
+	}
+}
@@ -39,10 +39,120 @@ type SimpleChaincode struct {
 type Message struct {
 	ObjectType string        `json:"docType"` //field for couchdb
 	Id         string        `json:"id"`      //the fieldtags are needed to keep case from bouncing around
-	Text       string        `json:"text"`
+	Text       string        `json:"text,omitempty"`   //never stored on the channel, only filled in by read_message
+	TextHash   string        `json:"text_hash"`        //sha256 of the salt and text, both live in the private collection
 	Priority   int			 `json:"priority"`
 	Sender     MessengerRelation `json:"sender"`
-	// Recipient  MessengerRelation `json:"recipient"`    //the person to whom the message is sent
+	Recipient  MessengerRelation `json:"recipient"`    //the person (or group) to whom the message is sent
+	ToGroup    bool          `json:"to_group,omitempty"`     //recipient is a group, see DeliveredTo
+	DeliveredTo []string     `json:"delivered_to,omitempty"` //ids of the group members whose inbox got the message
+	Collection string        `json:"collection"`       //private data collection holding the text
+	Orgs       []string      `json:"orgs"`             //msp ids of the sender/recipient org pair, members of the collection
+	SentAt     int64         `json:"sent_at"`          //unix seconds, from the transaction timestamp
+	ExpiresAt  int64         `json:"expires_at,omitempty"` //unix seconds, 0 never expires. expired messages read as gone
+	DeliverAt  int64         `json:"deliver_at,omitempty"` //unix seconds, inboxes hide the message until then
+	Escalations []Escalation `json:"escalations,omitempty"`
+	Marbles    []MarbleRef   `json:"marbles,omitempty"` //marbles referenced by the message, as they were when attached
+	Revision   int           `json:"revision"`          //number of edits, prior texts are kept in the collection
+	EditedAt   int64         `json:"edited_at,omitempty"`
+	EditedBy   *MessengerRelation `json:"edited_by,omitempty"`
+	Hidden     bool          `json:"hidden,omitempty"`  //hidden by a moderator, kept on the ledger but left out of inboxes
+	Conversation string      `json:"conversation"`      //the sender/recipient pair, or the group, see conversation_id()
+	Seq        int           `json:"seq"`               //position in the conversation, starting at 1
+	ContentHash string       `json:"content_hash"`      //text hash as sent, edits don't change it
+	PrevHash   string        `json:"prev_hash"`         //hash of the previous message in the conversation, "" for the first
+	Hash       string        `json:"hash"`              //see chain_hash()
+}
+
+// ----- Conversation Heads ----- //
+// the last link of a conversation's hash chain, stored under the composite key conversation_head~conversation
+type ConversationHead struct {
+	ObjectType string        `json:"docType"` //field for couchdb
+	Conversation string      `json:"conversation"`
+	Seq        int           `json:"seq"`
+	MessageId  string        `json:"message_id"`
+	Hash       string        `json:"hash"`
+}
+
+// ----- Reports ----- //
+// a recipient's report of a message, stored under the composite key report~id, id is the reporting tx id
+type Report struct {
+	ObjectType string        `json:"docType"` //field for couchdb
+	Id         string        `json:"id"`
+	MessageId  string        `json:"message_id"`
+	Reporter   MessengerRelation `json:"reporter"`
+	Reason     string        `json:"reason"`
+	Status     string        `json:"status"`  //open, hidden or dismissed
+	ReportedAt int64         `json:"reported_at"`
+	ResolvedAt int64         `json:"resolved_at,omitempty"`
+}
+
+// ----- Moderation Actions ----- //
+// one per report, hide and dismiss, stored under the composite key moderation_action~message~tx id for auditing
+type ModerationAction struct {
+	ObjectType string        `json:"docType"` //field for couchdb
+	TxId       string        `json:"tx_id"`
+	Action     string        `json:"action"`  //report, hide or dismiss
+	MessageId  string        `json:"message_id"`
+	ReportId   string        `json:"report_id"`
+	Reason     string        `json:"reason"`
+	By         string        `json:"by"`      //common name of the caller's cert
+	ByOrg      string        `json:"by_org"`  //msp id of the caller
+	At         int64         `json:"at"`
+}
+
+// ----- Marble References ----- //
+// a snapshot of a marble read from the marbles chaincode, TxId is the marble's ledger version at the time
+type MarbleRef struct {
+	Id         string        `json:"id"`
+	TxId       string        `json:"tx_id"`   //last transaction that wrote the marble
+	Owner      MarbleOwnerRelation `json:"owner"`
+	AttachedAt int64         `json:"attached_at,omitempty"`
+}
+
+// same shape as OwnerRelation in the marbles chaincode
+type MarbleOwnerRelation struct {
+	Id         string `json:"id"`
+	Username   string `json:"username"`
+	Company    string `json:"company"`
+}
+
+// a higher priority is more urgent, escalating only ever raises it
+type Escalation struct {
+	By         MessengerRelation `json:"by"`
+	From       int           `json:"from"`
+	To         int           `json:"to"`
+	At         int64         `json:"at"`
+}
+
+// ----- Receipts ----- //
+// one per message per recipient, stored under the composite key receipt~message~messenger
+type Receipt struct {
+	ObjectType string        `json:"docType"` //field for couchdb
+	MessageId  string        `json:"message_id"`
+	Messenger  MessengerRelation `json:"messenger"`
+	ReadAt     int64         `json:"read_at"`
+	AckedAt    int64         `json:"acked_at"`  //0 until acknowledged, reading is not acknowledging
+}
+
+// ----- Events ----- //
+// payload of the chaincode events, never carries the text
+type MessageEvent struct {
+	Action     string        `json:"action"`  //sent, read, ack or delete
+	MessageId  string        `json:"message_id"`
+	Sender     MessengerRelation `json:"sender"`
+	Recipient  MessengerRelation `json:"recipient"`
+	Priority   int           `json:"priority"`
+	Timestamp  int64         `json:"timestamp"`
+}
+
+// ----- Message Bodies ----- //
+// stored with PutPrivateData() in the message's collection, only the hash goes on the channel
+type MessageBody struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	Id         string `json:"id"`
+	Text       string `json:"text"`
+	Salt       string `json:"salt"`    //random hex from the client, hashed with the text so the hash can't be brute forced
 }
 
 // ----- Messengers ----- //
@@ -50,15 +160,77 @@ type Messenger struct {
 	ObjectType string `json:"docType"`     //field for couchdb
 	Id         string `json:"id"`
 	Username   string `json:"username"`
-	// Company    string `json:"company"`
+	Company    string `json:"company"`       //msp id of the org that created the messenger
+	DisplayName string `json:"display_name,omitempty"`
+	Contact    string `json:"contact,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
+	ContactPolicy string   `json:"contact_policy,omitempty"` //"open" (the default) or "allow_list"
+	AllowList  []string `json:"allow_list,omitempty"`       //messenger ids accepted under "allow_list"
+	Blocked    []string `json:"blocked,omitempty"`          //messenger ids refused under any policy
+}
+
+// ----- Tombstones ----- //
+// left behind under the composite key tombstone~message whenever a message is swept off the ledger
+type Tombstone struct {
+	ObjectType string        `json:"docType"` //field for couchdb
+	MessageId  string        `json:"message_id"`
+	Reason     string        `json:"reason"`
+	ExpiresAt  int64         `json:"expires_at"`
+	RemovedAt  int64         `json:"removed_at"`
+	TxId       string        `json:"tx_id"`   //the sweep that removed it
+}
+
+// ----- Config ----- //
+// a single document stored under "messaging_config"
+type MessagingConfig struct {
+	ObjectType  string           `json:"docType"`      //field for couchdb
+	PrioritySLA map[string]int64 `json:"priority_sla"` //priority -> seconds a message may go unacknowledged
+	DefaultRetention int64       `json:"default_retention"` //seconds a message lives when no expiry is given, 0 forever
+	Retention   map[string]int64 `json:"retention"`    //recipient messenger id -> seconds, overrides the default
+	EditWindow  int64            `json:"edit_window"`  //seconds after sending a message can be edited, 0 no limit
+	RateLimit   RateLimit        `json:"rate_limit"`   //sends allowed per messenger per window
+	RateLimits  map[string]RateLimit `json:"rate_limits"` //sender messenger id -> limit, overrides the default
+}
+
+// a Count of 0 is no limit
+type RateLimit struct {
+	Count       int              `json:"count"`
+	Window      int64            `json:"window"`       //seconds
+}
+
+// one shard of a messenger's send counter, stored under send_count~messenger~shard
+type SendCount struct {
+	Window      int64            `json:"window"`       //start of the window the count is for, older counts are stale
+	Count       int              `json:"count"`
+}
+
+// ----- Groups ----- //
+// members are stored under the composite key group~member, not in the group itself
+type Group struct {
+	ObjectType string        `json:"docType"` //field for couchdb
+	Id         string        `json:"id"`
+	Name       string        `json:"name"`
+	Org        string        `json:"org"`     //msp id of the org that created the group, group messages use its collection
+	Admins     []MessengerRelation `json:"admins"`
 }
 
 type MessengerRelation struct {
 	Id         string `json:"id"`
 	Username   string `json:"username"`    //this is mostly cosmetic/handy, the real relation is by Id not Username
-	// Company    string `json:"company"`     //this is mostly cosmetic/handy, the real relation is by Id not Company
+	Company    string `json:"company"`     //this is mostly cosmetic/handy, the real relation is by Id not Company
 }
 
+// status codes of errors clients need to tell apart, shim.Error() is always a 500
+const (
+	BLOCKED   = 403         //the recipient refuses messages from the sender
+	NOT_FOUND = 404         //the sender or recipient does not exist
+	RATE_LIMITED = 429      //the sender used up their sends for this window
+)
+
+// chaincode name the marbles chaincode was instantiated with on this channel
+var marbles_chaincode = "marbles"
+var SEND_COUNT_SHARDS = 8                                      //send counter keys per messenger, see count_send()
+
 // ============================================================================================================================
 // Main
 // ============================================================================================================================
@@ -127,8 +299,72 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return init_message(stub, args)
 	// } else if function == "set_owner" {        //change owner of a message
 	// 	return set_owner(stub, args)
-	} else if function == "init_owner"{        //create a new messenger
-		return init_owner(stub, args)
+	} else if function == "init_messenger"{    //create a new messenger
+		return init_messenger(stub, args)
+	} else if function == "update_messenger"{  //update a messenger's profile
+		return update_messenger(stub, args)
+	} else if function == "read_message"{      //read a message and its private text
+		return read_message(stub, args)
+	} else if function == "mark_read"{         //recipient marks a message as read
+		return mark_read(stub, args)
+	} else if function == "ack_message"{       //recipient acknowledges a message
+		return ack_message(stub, args)
+	} else if function == "escalate_message"{  //raise the priority of a message
+		return escalate_message(stub, args)
+	} else if function == "sweep_expired"{     //admin - remove a batch of expired messages
+		return sweep_expired(stub, args)
+	} else if function == "set_retention"{     //admin - set how long messages live
+		return set_retention(stub, args)
+	} else if function == "set_rate_limit"{    //admin - set how many messages a messenger may send per window
+		return set_rate_limit(stub, args)
+	} else if function == "set_priority_sla"{  //set how long a priority level may go unacknowledged
+		return set_priority_sla(stub, args)
+	} else if function == "getInboxByPriority"{ //read a messenger's inbox, most urgent first
+		return getInboxByPriority(stub, args)
+	} else if function == "getOverdueMessages"{ //read a messenger's messages that are past their sla
+		return getOverdueMessages(stub, args)
+	} else if function == "block_messenger"{   //refuse messages from a messenger
+		return block_messenger(stub, args)
+	} else if function == "unblock_messenger"{ //accept messages from a blocked messenger again
+		return unblock_messenger(stub, args)
+	} else if function == "set_contact_policy"{ //accept messages from anyone, or only from an allow list
+		return set_contact_policy(stub, args)
+	} else if function == "cancel_scheduled_message"{ //sender cancels a message that wasn't delivered yet
+		return cancel_scheduled_message(stub, args)
+	} else if function == "getScheduledMessages"{ //read a sender's messages that weren't delivered yet
+		return getScheduledMessages(stub, args)
+	} else if function == "edit_message"{      //sender edits a message, keeping the prior revision
+		return edit_message(stub, args)
+	} else if function == "set_edit_window"{   //admin - set how long after sending a message can be edited
+		return set_edit_window(stub, args)
+	} else if function == "getMessageRevisions"{ //read every revision of a message
+		return getMessageRevisions(stub, args)
+	} else if function == "report_message"{    //recipient reports a message to the moderators
+		return report_message(stub, args)
+	} else if function == "hide_message"{      //admin - hide a reported message
+		return hide_message(stub, args)
+	} else if function == "dismiss_report"{    //admin - dismiss a report
+		return dismiss_report(stub, args)
+	} else if function == "getModerationQueue"{ //admin - read the open reports
+		return getModerationQueue(stub, args)
+	} else if function == "verifyConversation"{ //recompute a conversation's hash chain
+		return verifyConversation(stub, args)
+	} else if function == "exportMailbox"{     //read a page of a messenger's inbox and outbox as a self describing bundle
+		return exportMailbox(stub, args)
+	} else if function == "searchMessages"{    //find messages by keyword
+		return searchMessages(stub, args)
+	} else if function == "attach_marble"{     //reference a marble from a message
+		return attach_marble(stub, args)
+	} else if function == "verifyMarbleRefs"{  //check if a message's marbles changed since they were attached
+		return verifyMarbleRefs(stub, args)
+	} else if function == "init_group"{        //create a new group
+		return init_group(stub, args)
+	} else if function == "add_group_member"{  //group admin adds a member
+		return add_group_member(stub, args)
+	} else if function == "remove_group_member"{ //group admin removes a member
+		return remove_group_member(stub, args)
+	} else if function == "getGroupMembers"{   //read the members of a group
+		return getGroupMembers(stub, args)
 	} else if function == "read_everything"{   //read everything, (messengers + messages + companies)
 		return read_everything(stub)
 	} else if function == "getHistory"{        //read history of a message (audit)
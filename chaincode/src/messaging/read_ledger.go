@@ -23,6 +23,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -38,7 +41,7 @@ import (
 //  key
 //  "abc"
 //
-// Returns - string
+// Returns - string, nothing for an expired message
 // ============================================================================================================================
 func read(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var key, jsonResp string
@@ -61,11 +64,90 @@ func read(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		jsonResp = "{\"Error\":\"Failed to get state for " + key + "\"}"
 		return shim.Error(jsonResp)
 	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if is_expired_record(valAsbytes, now) {           //expired messages are as good as gone
+		valAsbytes = nil
+	}
 
 	fmt.Println("- end read")
 	return shim.Success(valAsbytes)                  //send it onward
 }
 
+// ============================================================================================================================
+// Read Message - read a message and fill in its text from the private data collection
+//
+// Shows Off GetPrivateData() - only members of the sender/recipient org pair can read the text
+//
+// Inputs - Array of strings
+//      0      ,          1
+//      id     , messenger id (optional)
+// "m999999999", "o99999999999"
+//
+// A scheduled message reads as not existing until it is delivered, except to its sender, who must be given as the
+// messenger, see init_message()
+// A message hidden by a moderator reads as not existing, except to messaging admins
+//
+// Returns - message with "text" filled in
+// ============================================================================================================================
+func read_message(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting read_message")
+
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	id := args[0]
+	message, err := get_live_message(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// hide scheduled messages from everyone but the sender, as inboxes do
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if is_pending(message, now) {
+		if len(args) != 2 || args[1] != message.Sender.Id {
+			return shim.Error("Message does not exist - " + id)
+		}
+		_, err = get_acting_messenger(stub, args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// hidden messages are left out of reads, admins still see them
+	if message.Hidden && check_admin(stub) != nil {
+		return shim.Error("Message does not exist - " + id)
+	}
+
+	// only the two orgs of the collection get to see the text
+	err = check_collection_member(stub, message)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	message.Text, err = get_message_text(stub, message)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end read_message")
+	messageAsBytes, _ := json.Marshal(message)       //convert to array of bytes
+	return shim.Success(messageAsBytes)
+}
+
 // ============================================================================================================================
 // Get everything we need (messengers + messages + companies)
 //
@@ -95,6 +177,12 @@ func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 	}
 	var everything Everything
 
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	is_admin := check_admin(stub) == nil
+
 	// ---- Get All Messages ---- //
 	resultsIterator, err := stub.GetStateByRange("m0", "m9999999999999999999")
 	if err != nil {
@@ -111,6 +199,15 @@ func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 		fmt.Println("on message id - ", queryKeyAsStr)
 		var message Message
 		json.Unmarshal(queryValAsBytes, &message)                  //un stringify it aka JSON.parse()
+		if is_expired(message, now) {                              //expired messages are as good as gone
+			continue
+		}
+		if is_pending(message, now) {                              //scheduled messages don't exist until delivered
+			continue
+		}
+		if message.Hidden && !is_admin {                           //hidden by a moderator, admins still see them
+			continue
+		}
 		everything.Messages = append(everything.Messages, message)   //add this message to the list
 	}
 	fmt.Println("message array - ", everything.Messages)
@@ -145,6 +242,8 @@ func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 //
 // Shows Off GetHistoryForKey() - reading complete history of a key/value
 //
+// Versions of an expired message read as empty, like a deleted one
+//
 // Inputs - Array of strings
 //  0
 //  id
@@ -165,6 +264,11 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	messageId := args[0]
 	fmt.Printf("- start getHistoryForMessage: %s\n", messageId)
 
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Get History
 	resultsIterator, err := stub.GetHistoryForKey(messageId)
 	if err != nil {
@@ -181,7 +285,7 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		var tx AuditHistory
 		tx.TxId = txID                             //copy transaction id over
 		json.Unmarshal(historicValue, &message)     //un stringify it aka JSON.parse()
-		if historicValue == nil {                  //message has been deleted
+		if historicValue == nil || is_expired_record(historicValue, now) { //message has been deleted or expired
 			var emptyMessage Message
 			tx.Value = emptyMessage                 //copy nil message
 		} else {
@@ -206,6 +310,8 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 //       0     ,    1
 //   startKey  ,  endKey
 //  "messages1" , "messages5"
+//
+// Expired messages are left out
 // ============================================================================================================================
 func getMessagesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 2 {
@@ -215,6 +321,11 @@ func getMessagesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Resp
 	startKey := args[0]
 	endKey := args[1]
 
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -231,6 +342,9 @@ func getMessagesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Resp
 		if err != nil {
 			return shim.Error(err.Error())
 		}
+		if is_expired_record(queryResultValue, now) {           //expired messages are as good as gone
+			continue
+		}
 		// Add a comma before array members, suppress it for the first array member
 		if bArrayMemberAlreadyWritten == true {
 			buffer.WriteString(",")
@@ -252,3 +366,767 @@ func getMessagesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Resp
 
 	return shim.Success(buffer.Bytes())
 }
+
+// ============================================================================================================================
+// Get inbox by priority - read a messenger's inbox, highest priority first, then oldest first
+//
+// Inputs - Array of strings
+//        0
+//   messenger id
+//  "o99999999999"
+// ============================================================================================================================
+func getInboxByPriority(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	messenger_id := args[0]
+	fmt.Printf("- start getInboxByPriority: %s\n", messenger_id)
+
+	messages, err := get_inbox(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sort.Sort(ByPriority(messages))
+
+	//change to array of bytes
+	messagesAsBytes, _ := json.Marshal(messages)   //convert to array of bytes
+	return shim.Success(messagesAsBytes)
+}
+
+// ============================================================================================================================
+// Get overdue messages - read a messenger's unacknowledged messages that are past the sla of their priority
+//
+// Inputs - Array of strings
+//        0
+//   messenger id
+//  "o99999999999"
+// ============================================================================================================================
+func getOverdueMessages(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var overdue []Message
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	messenger_id := args[0]
+	fmt.Printf("- start getOverdueMessages: %s\n", messenger_id)
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := get_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	messages, err := get_inbox(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, message := range messages {
+		sla, ok := config.PrioritySLA[strconv.Itoa(message.Priority)]
+		if !ok || now - delivered_at(message) <= sla { //no sla for this priority, or still within it
+			continue
+		}
+		receipt, err := get_receipt(stub, message.Id, messenger_id)
+		if err == nil && receipt.AckedAt != 0 {      //already acknowledged
+			continue
+		}
+		overdue = append(overdue, message)
+	}
+	sort.Sort(ByPriority(overdue))
+
+	//change to array of bytes
+	overdueAsBytes, _ := json.Marshal(overdue)     //convert to array of bytes
+	return shim.Success(overdueAsBytes)
+}
+
+// ByPriority sorts messages by priority, highest first, then by time delivered, oldest first
+type ByPriority []Message
+
+func (a ByPriority) Len() int      { return len(a) }
+func (a ByPriority) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a ByPriority) Less(i, j int) bool {
+	if a[i].Priority != a[j].Priority {
+		return a[i].Priority > a[j].Priority
+	}
+	return delivered_at(a[i]) < delivered_at(a[j])
+}
+
+// ============================================================================================================================
+// Get group members - read the current members of a group
+//
+// Inputs - Array of strings
+//       0
+//    group id
+//  "g999999999"
+// ============================================================================================================================
+func getGroupMembers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	group_id := args[0]
+	fmt.Printf("- start getGroupMembers: %s\n", group_id)
+
+	_, err := get_group(stub, group_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	members, err := get_group_members(stub, group_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//change to array of bytes
+	membersAsBytes, _ := json.Marshal(members)     //convert to array of bytes
+	return shim.Success(membersAsBytes)
+}
+
+// ============================================================================================================================
+// Verify marble refs - compare each marble attached to a message with the marble as it is now
+//
+// Inputs - Array of strings
+//       0
+//   message id
+//  "m999999999"
+//
+// Returns - one entry per attached marble, "changed" is true if the marble was written or deleted since
+// ============================================================================================================================
+func verifyMarbleRefs(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type RefCheck struct {
+		Attached MarbleRef `json:"attached"`
+		Current  MarbleRef `json:"current"`
+		Deleted  bool      `json:"deleted"`
+		OwnerChanged bool  `json:"owner_changed"`
+		Changed  bool      `json:"changed"`
+	}
+	var checks []RefCheck
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	message_id := args[0]
+	fmt.Printf("- start verifyMarbleRefs: %s\n", message_id)
+
+	message, err := get_live_message(stub, message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, attached := range message.Marbles {
+		var check RefCheck
+		check.Attached = attached
+		check.Current, err = get_marble_ref(stub, attached.Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if check.Current.Id != attached.Id {
+			check.Deleted = true
+			check.Changed = true
+		} else {
+			check.OwnerChanged = check.Current.Owner.Id != attached.Owner.Id
+			check.Changed = check.Current.TxId != attached.TxId
+		}
+		checks = append(checks, check)
+	}
+
+	//change to array of bytes
+	checksAsBytes, _ := json.Marshal(checks)       //convert to array of bytes
+	return shim.Success(checksAsBytes)
+}
+
+// ============================================================================================================================
+// Get message revisions - read every revision of a message, oldest first
+//
+// Shows Off GetHistoryForKey() - each edit is a write of the message, the texts come from the private collection
+//
+// Inputs - Array of strings
+//       0
+//   message id
+//  "m999999999"
+// ============================================================================================================================
+func getMessageRevisions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type MessageRevision struct {
+		Revision int                `json:"revision"`
+		TxId     string             `json:"txId"`
+		TextHash string             `json:"text_hash"`
+		Text     string             `json:"text"`
+		EditedAt int64              `json:"edited_at,omitempty"`
+		EditedBy *MessengerRelation `json:"edited_by,omitempty"`
+	}
+	var revisions []MessageRevision
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	message_id := args[0]
+	fmt.Printf("- start getMessageRevisions: %s\n", message_id)
+
+	message, err := get_live_message(stub, message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only the two orgs of the collection get to see the texts
+	err = check_collection_member(stub, message)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetHistoryForKey(message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		txID, historicValue, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var historic Message
+		json.Unmarshal(historicValue, &historic)           //un stringify it aka JSON.parse()
+		if historic.Id != message.Id {                     //message was deleted at this point
+			revisions = nil                                //what came before belongs to an older message with this id
+			continue
+		}
+		if len(revisions) > 0 && revisions[len(revisions)-1].Revision == historic.Revision {
+			continue                                       //written for another reason than an edit
+		}
+
+		var revision MessageRevision
+		revision.Revision = historic.Revision
+		revision.TxId = txID
+		revision.TextHash = historic.TextHash
+		revision.EditedAt = historic.EditedAt
+		revision.EditedBy = historic.EditedBy
+		body, err := get_revision_body(stub, message, historic.Revision)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		revision.Text = body.Text
+		if text_hash(body.Salt, body.Text) != historic.TextHash { //private data must match the hash on the channel
+			return shim.Error("Private text does not match the ledger hash for revision " + strconv.Itoa(historic.Revision) + " of message - " + message.Id)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	//change to array of bytes
+	revisionsAsBytes, _ := json.Marshal(revisions) //convert to array of bytes
+	return shim.Success(revisionsAsBytes)
+}
+
+// ============================================================================================================================
+// Search messages - find the messages a messenger can see that contain all ("and") or any ("or") of the terms
+//
+// Shows Off GetStateByPartialCompositeKey() - reading the term~message index one term at a time
+//
+// Inputs - Array of strings
+//        0      ,   1  ,    2...
+//  messenger id , mode ,   terms
+// "o99999999999", "and", "marble", "trade"
+//
+// The messenger must belong to the caller's org, and only the collections the caller's org is in can be searched
+//
+// Returns - matching messages, with their text
+// ============================================================================================================================
+func searchMessages(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var results []Message
+
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 3")
+	}
+
+	mode := strings.ToLower(args[1])
+	if mode != "and" && mode != "or" {
+		return shim.Error("2nd argument must be 'and' or 'or'")
+	}
+	terms := tokenize(strings.Join(args[2:], " "))   //normalized the same way the index was
+	if len(terms) == 0 {
+		return shim.Error("No searchable terms given")
+	}
+
+	// the messenger must belong to the caller's org
+	messenger, err := get_acting_messenger(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	messenger_id := messenger.Id
+	fmt.Printf("- start searchMessages: %s %s %v\n", messenger_id, mode, terms)
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the index is keyed per collection, search the collections of the messenger's messages
+	inbox, err := get_inbox(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	outbox, err := get_outbox(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var collections []string
+	for _, message := range append(inbox, outbox...) {
+		if !contains(collections, message.Collection) {
+			collections = append(collections, message.Collection)
+		}
+	}
+	sort.Strings(collections)
+
+	// combine the ids of each term, a message is in one collection so terms combine within it
+	matches := map[string]bool{}
+	for _, collection := range collections {
+		secret, err := get_search_secret(stub, collection, "")
+		if err != nil {
+			continue                                 //this peer's org isn't in the collection
+		}
+
+		var collection_matches map[string]bool
+		for _, term := range terms {
+			ids, err := get_term_messages(stub, secret, term)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if collection_matches == nil {
+				collection_matches = ids
+			} else if mode == "or" {
+				for id := range ids {
+					collection_matches[id] = true
+				}
+			} else {
+				for id := range collection_matches {
+					if !ids[id] {
+						delete(collection_matches, id)
+					}
+				}
+			}
+		}
+		for id := range collection_matches {
+			matches[id] = true
+		}
+	}
+
+	// only keep what the messenger is allowed to see
+	var ids []string
+	for id := range matches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)                                //map order is random, keep results the same on every peer
+	for _, id := range ids {
+		message, err := get_live_message(stub, id)
+		if err != nil {
+			continue                                 //stale index entry, message is gone
+		}
+		if message.Sender.Id != messenger_id && (!is_recipient(message, messenger_id) || is_pending(message, now) || message.Hidden) {
+			continue
+		}
+		if check_collection_member(stub, message) != nil {
+			continue
+		}
+		message.Text, err = get_message_text(stub, message)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		results = append(results, message)
+	}
+
+	//change to array of bytes
+	resultsAsBytes, _ := json.Marshal(results)     //convert to array of bytes
+	return shim.Success(resultsAsBytes)
+}
+
+// ============================================================================================================================
+// Get scheduled messages - read a sender's messages that are not delivered yet, soonest first
+//
+// Only the sender's org can list them, to everyone else they don't exist yet
+//
+// Inputs - Array of strings
+//        0
+//    sender id
+//  "o99999999999"
+// ============================================================================================================================
+func getScheduledMessages(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var scheduled []Message
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	messenger_id := args[0]
+	fmt.Printf("- start getScheduledMessages: %s\n", messenger_id)
+
+	_, err := get_acting_messenger(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	messages, err := get_outbox(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, message := range messages {
+		if is_pending(message, now) && !is_expired(message, now) {
+			scheduled = append(scheduled, message)
+		}
+	}
+	sort.Sort(ByDeliverAt(scheduled))
+
+	//change to array of bytes
+	scheduledAsBytes, _ := json.Marshal(scheduled) //convert to array of bytes
+	return shim.Success(scheduledAsBytes)
+}
+
+// ByDeliverAt sorts messages by when they get delivered, soonest first
+type ByDeliverAt []Message
+
+func (a ByDeliverAt) Len() int           { return len(a) }
+func (a ByDeliverAt) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByDeliverAt) Less(i, j int) bool { return delivered_at(a[i]) < delivered_at(a[j]) }
+
+// ============================================================================================================================
+// Get moderation queue - admin reads the open reports, oldest first
+//
+// Inputs - none
+// ============================================================================================================================
+func getModerationQueue(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var queue []Report
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	err := check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("report", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, queryValAsBytes, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var report Report
+		json.Unmarshal(queryValAsBytes, &report)   //un stringify it aka JSON.parse()
+		if report.Status == "open" {
+			queue = append(queue, report)
+		}
+	}
+	sort.Sort(ByReportedAt(queue))
+
+	//change to array of bytes
+	queueAsBytes, _ := json.Marshal(queue)         //convert to array of bytes
+	return shim.Success(queueAsBytes)
+}
+
+// ByReportedAt sorts reports by when they were reported, oldest first
+type ByReportedAt []Report
+
+func (a ByReportedAt) Len() int           { return len(a) }
+func (a ByReportedAt) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByReportedAt) Less(i, j int) bool { return a[i].ReportedAt < a[j].ReportedAt }
+
+// ============================================================================================================================
+// Verify conversation - recompute a conversation's hash chain from the ledger and report gaps and mismatches
+//
+// Inputs - Array of strings
+//        0      ,       1
+//  messenger id , messenger id
+// "o99999999999", "o88888888888"
+//
+// or a single group id for a group's conversation
+// ============================================================================================================================
+func verifyConversation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type Issue struct {
+		Seq       int    `json:"seq"`
+		MessageId string `json:"message_id"`
+		Problem   string `json:"problem"`
+	}
+	type Verification struct {
+		Conversation string  `json:"conversation"`
+		Length       int     `json:"length"`
+		HeadHash     string  `json:"head_hash"`
+		Valid        bool    `json:"valid"`
+		Issues       []Issue `json:"issues"`
+	}
+	var verification Verification
+
+	if len(args) == 1 {
+		verification.Conversation = conversation_id("", args[0], true)
+	} else if len(args) == 2 {
+		verification.Conversation = conversation_id(args[0], args[1], false)
+	} else {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
+	}
+	fmt.Printf("- start verifyConversation: %s\n", verification.Conversation)
+
+	head, err := get_conversation_head(stub, verification.Conversation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	verification.Length = head.Seq
+	verification.HeadHash = head.Hash
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("conversation~message", []string{verification.Conversation})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	expected := 1                                    //seq of the next link
+	prev_hash := ""                                  //hash of the previous link, "" if it couldn't be verified
+	for resultsIterator.HasNext() {
+		indexKey, _, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(indexKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		seq, _ := strconv.Atoi(keyParts[1])
+		message_id := keyParts[2]
+
+		for ; expected < seq; expected++ {           //links that were never indexed
+			verification.Issues = append(verification.Issues, Issue{Seq: expected, Problem: "gap, no message at this position"})
+			prev_hash = ""
+		}
+		expected = seq + 1
+
+		message, err := get_message(stub, message_id)
+		if err != nil {                              //removed since, say why if we know
+			problem := "gap, message was removed"
+			tombstone_key, _ := stub.CreateCompositeKey("tombstone", []string{message_id})
+			tombstoneAsBytes, _ := stub.GetState(tombstone_key)
+			var tombstone Tombstone
+			json.Unmarshal(tombstoneAsBytes, &tombstone) //un stringify it aka JSON.parse()
+			if tombstone.MessageId == message_id {
+				problem = "gap, message was removed - " + tombstone.Reason
+			}
+			verification.Issues = append(verification.Issues, Issue{Seq: seq, MessageId: message_id, Problem: problem})
+			prev_hash = ""
+			continue
+		}
+
+		if message.Seq != seq || message.Conversation != verification.Conversation {
+			verification.Issues = append(verification.Issues, Issue{Seq: seq, MessageId: message_id, Problem: "mismatch, message is not at this position"})
+		} else if chain_hash(message) != message.Hash {
+			verification.Issues = append(verification.Issues, Issue{Seq: seq, MessageId: message_id, Problem: "mismatch, hash does not match the message"})
+		} else if seq > 1 && prev_hash != "" && message.PrevHash != prev_hash {
+			verification.Issues = append(verification.Issues, Issue{Seq: seq, MessageId: message_id, Problem: "mismatch, previous hash does not match the previous message"})
+		} else if seq == 1 && message.PrevHash != "" {
+			verification.Issues = append(verification.Issues, Issue{Seq: seq, MessageId: message_id, Problem: "mismatch, first message has a previous hash"})
+		}
+		prev_hash = message.Hash
+	}
+
+	for ; expected <= head.Seq; expected++ {         //links after the last indexed one
+		verification.Issues = append(verification.Issues, Issue{Seq: expected, Problem: "gap, no message at this position"})
+		prev_hash = ""
+	}
+	if head.Seq > 0 && prev_hash != "" && prev_hash != head.Hash {
+		verification.Issues = append(verification.Issues, Issue{Seq: head.Seq, MessageId: head.MessageId, Problem: "mismatch, last message does not match the conversation head"})
+	}
+	verification.Valid = len(verification.Issues) == 0
+
+	//change to array of bytes
+	verificationAsBytes, _ := json.Marshal(verification) //convert to array of bytes
+	return shim.Success(verificationAsBytes)
+}
+
+// ============================================================================================================================
+// Export mailbox - read a page of a messenger's inbox, then outbox, as a self describing bundle with a manifest hash
+//
+// Inputs - Array of strings
+//        0      ,     1    ,         2
+//  messenger id , page size, bookmark (optional, from the previous page)
+// "o99999999999",   "50"   , "inbox:m999999999"
+//
+// Returns - {"bundle": {...}, "manifest": {...}, "export": {...}}. the bundle only holds what is read from the ledger, the
+// messenger, messages, receipts and threads in a fixed order, and the manifest's sha256 is over its bytes exactly as
+// returned. exporting the same page again reproduces the hash as long as the ledger didn't change, so keep the bundle
+// as is to check it against the ledger later. "export" holds when and by which tx the page was exported, and the
+// bookmarks, page until its next_bookmark is ""
+// ============================================================================================================================
+func exportMailbox(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type ExportedMessage struct {
+		Box      string    `json:"box"`       //inbox or outbox
+		Message  Message   `json:"message"`   //with its text if this peer's org may read it
+		Receipts []Receipt `json:"receipts"`
+	}
+	type Thread struct {
+		Conversation string `json:"conversation"`
+		Links        []ThreadLink `json:"links"`   //this page's messages of the conversation, by seq
+	}
+	type Bundle struct {
+		Format       string            `json:"format"`
+		Version      int               `json:"version"`
+		Messenger    Messenger         `json:"messenger"`
+		Messages     []ExportedMessage `json:"messages"`
+		Threads      []Thread          `json:"threads"`
+	}
+	type Manifest struct {
+		Algorithm    string `json:"algorithm"`
+		Sha256       string `json:"sha256"`
+		MessageCount int    `json:"message_count"`
+		ReceiptCount int    `json:"receipt_count"`
+	}
+	type ExportInfo struct {
+		ExportedAt   int64  `json:"exported_at"`
+		TxId         string `json:"tx_id"`
+		Bookmark     string `json:"bookmark"`
+		NextBookmark string `json:"next_bookmark"`
+	}
+	type Export struct {
+		Bundle   json.RawMessage `json:"bundle"`
+		Manifest Manifest        `json:"manifest"`
+		Export   ExportInfo      `json:"export"`
+	}
+	var bundle Bundle
+	var info ExportInfo
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	page_size, err := strconv.Atoi(args[1])
+	if err != nil || page_size <= 0 || page_size > 100 {
+		return shim.Error("2nd argument must be a numeric string between 1 and 100")
+	}
+	bookmark_box, bookmark_id := "inbox", ""
+	if len(args) == 3 && args[2] != "" {
+		parts := strings.SplitN(args[2], ":", 2)
+		if len(parts) != 2 || (parts[0] != "inbox" && parts[0] != "outbox") {
+			return shim.Error("3rd argument must be a bookmark from a previous page")
+		}
+		bookmark_box, bookmark_id = parts[0], parts[1]
+		info.Bookmark = args[2]
+	}
+
+	// only the messenger's own org can export it
+	messenger, err := get_acting_messenger(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("- start exportMailbox: %s %s\n", messenger.Id, info.Bookmark)
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bundle.Format = "messaging-mailbox-export"
+	bundle.Version = 1
+	bundle.Messenger = messenger
+	info.ExportedAt = now
+	info.TxId = stub.GetTxID()
+
+	// inbox first, then outbox, each in message id order
+	var receipt_count int
+	threads := map[string][]ThreadLink{}
+	for _, box := range []string{"inbox", "outbox"} {
+		if box == "inbox" && bookmark_box == "outbox" {
+			continue                                 //inbox was exported by earlier pages
+		}
+
+		var messages []Message
+		if box == "inbox" {
+			messages, err = get_inbox(stub, messenger.Id)
+		} else {
+			messages, err = get_outbox(stub, messenger.Id)
+		}
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		for _, message := range messages {
+			if box == bookmark_box && message.Id <= bookmark_id {
+				continue                             //exported by earlier pages
+			}
+			if is_expired(message, now) {
+				continue
+			}
+			if len(bundle.Messages) == page_size {   //page is full, there is more
+				last := bundle.Messages[page_size-1]
+				if last.Box == box {
+					info.NextBookmark = box + ":" + last.Message.Id
+				} else {
+					info.NextBookmark = box + ":"  //page ended in the inbox, start this box from its first message
+				}
+				break
+			}
+
+			if check_collection_member(stub, message) == nil {
+				message.Text, _ = get_message_text(stub, message)
+			}
+			receipts, err := get_receipts(stub, message.Id)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			receipt_count += len(receipts)
+
+			bundle.Messages = append(bundle.Messages, ExportedMessage{Box: box, Message: message, Receipts: receipts})
+			threads[message.Conversation] = append(threads[message.Conversation], ThreadLink{Seq: message.Seq, MessageId: message.Id, PrevHash: message.PrevHash, Hash: message.Hash})
+		}
+		if info.NextBookmark != "" {
+			break
+		}
+	}
+
+	// thread structure, sorted so every peer builds the same bytes
+	var conversations []string
+	for conversation := range threads {
+		conversations = append(conversations, conversation)
+	}
+	sort.Strings(conversations)
+	for _, conversation := range conversations {
+		links := threads[conversation]
+		sort.Sort(BySeq(links))
+		bundle.Threads = append(bundle.Threads, Thread{Conversation: conversation, Links: links})
+	}
+
+	var export Export
+	export.Bundle, _ = json.Marshal(bundle)          //convert to array of bytes
+	export.Manifest.Algorithm = "sha256"
+	export.Manifest.Sha256 = hash_text(string(export.Bundle))
+	export.Manifest.MessageCount = len(bundle.Messages)
+	export.Manifest.ReceiptCount = receipt_count
+	export.Export = info
+
+	//change to array of bytes
+	exportAsBytes, _ := json.Marshal(export)         //convert to array of bytes
+	return shim.Success(exportAsBytes)
+}
+
+// a message's link in its conversation's hash chain, as exported
+type ThreadLink struct {
+	Seq       int    `json:"seq"`
+	MessageId string `json:"message_id"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+}
+
+// BySeq sorts links by their position in the conversation
+type BySeq []ThreadLink
+
+func (a BySeq) Len() int           { return len(a) }
+func (a BySeq) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a BySeq) Less(i, j int) bool { return a[i].Seq < a[j].Seq }
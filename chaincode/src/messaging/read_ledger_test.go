@@ -0,0 +1,336 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadMessageFillsTextForCollectionMember(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "meet at noon"))
+
+	s.as(org2, "bob")
+	res := s.invoke("read_message", "m1")
+	checkOK(t, res)
+	var message Message
+	json.Unmarshal(res.Payload, &message)
+	if message.Text != "meet at noon" {
+		t.Fatalf("expected the text, got '%s'", message.Text)
+	}
+}
+
+func TestReadMessageRefusesOtherOrgs(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "meet at noon"))
+
+	s.as(org3, "eve")
+	checkError(t, s.invoke("read_message", "m1"), 500, "not a member of collection")
+}
+
+func TestInboxByPriority(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "first"))
+	s.now++
+	checkOK(t, s.send(org1, "m2", "o1", "o2", "second"))
+	s.now++
+	checkOK(t, s.send(org1, "m3", "o1", "o2", "third"))
+
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("escalate_message", "m3", "o2", "5"))
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o2")), "m3", "m1", "m2")
+}
+
+func TestOverdueMessagesUntilAcked(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	s.admin(org1)
+	checkOK(t, s.invoke("set_priority_sla", "1", "60"))
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "ship it"))
+
+	checkIds(t, messageIds(t, s.invoke("getOverdueMessages", "o2")))
+	s.now += 61
+	checkIds(t, messageIds(t, s.invoke("getOverdueMessages", "o2")), "m1")
+
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("ack_message", "m1", "o2"))
+	checkIds(t, messageIds(t, s.invoke("getOverdueMessages", "o2")))
+}
+
+func TestExpiredMessageReadsAsGone(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "soon gone", strconv.FormatInt(s.now+10, 10)))
+
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("read_message", "m1"))
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o2")), "m1")
+
+	s.now += 10
+	checkError(t, s.invoke("read_message", "m1"), 500, "does not exist")
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o2")))
+	res := s.invoke("read", "m1")
+	checkOK(t, res)
+	if res.Payload != nil {
+		t.Fatalf("read returned an expired message")
+	}
+	res = s.invoke("getMessagesByRange", "m0", "m9")
+	checkOK(t, res)
+	if string(res.Payload) != "[]" {
+		t.Fatalf("range returned an expired message - %s", res.Payload)
+	}
+	res = s.invoke("getHistory", "m1")
+	checkOK(t, res)
+	var history []struct {
+		Value Message `json:"value"`
+	}
+	json.Unmarshal(res.Payload, &history)
+	if len(history) == 0 || history[0].Value.Id != "" {
+		t.Fatalf("history returned an expired message - %s", res.Payload)
+	}
+}
+
+func TestVerifyMarbleRefsSeesOwnerChange(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "look at this one"))
+	histories := map[string]string{
+		"marble1": `[{"txId":"mtx1","value":{"id":"marble1","owner":{"id":"o1"}}}]`,
+	}
+	s.invoked = marblesChaincode(histories)
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("attach_marble", "m1", "o1", "marble1"))
+
+	var checks []struct {
+		OwnerChanged bool `json:"owner_changed"`
+		Changed      bool `json:"changed"`
+	}
+	res := s.invoke("verifyMarbleRefs", "m1")
+	checkOK(t, res)
+	json.Unmarshal(res.Payload, &checks)
+	if len(checks) != 1 || checks[0].Changed {
+		t.Fatalf("unchanged marble reported as changed - %s", res.Payload)
+	}
+
+	histories["marble1"] = `[{"txId":"mtx1","value":{"id":"marble1","owner":{"id":"o1"}}},{"txId":"mtx2","value":{"id":"marble1","owner":{"id":"o2"}}}]`
+	res = s.invoke("verifyMarbleRefs", "m1")
+	checkOK(t, res)
+	json.Unmarshal(res.Payload, &checks)
+	if !checks[0].Changed || !checks[0].OwnerChanged {
+		t.Fatalf("owner change not seen - %s", res.Payload)
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "Marble trade at noon"))
+	checkOK(t, s.send(org1, "m2", "o1", "o2", "No trade today"))
+
+	s.as(org2, "bob")
+	checkIds(t, messageIds(t, s.invoke("searchMessages", "o2", "and", "trade", "noon")), "m1")
+	checkIds(t, messageIds(t, s.invoke("searchMessages", "o2", "or", "marble", "today")), "m1", "m2")
+
+	for key := range s.MockStub.State {
+		if strings.Contains(key, "noon") {
+			t.Fatalf("search index leaks a term - %q", key)
+		}
+	}
+}
+
+func TestSearchMessagesRefusesOtherOrgs(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	s.messenger(t, org3, "o3", "eve")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "Marble trade at noon"))
+
+	s.as(org3, "eve")
+	checkError(t, s.invoke("searchMessages", "o2", "and", "trade"), 500, "cannot act for messenger")
+	checkIds(t, messageIds(t, s.invoke("searchMessages", "o3", "and", "trade")))
+}
+
+// ============================================================================================================================
+// Scheduled messages - hidden from the recipient until deliver at, listed for the sender's org only
+// ============================================================================================================================
+func TestScheduledMessageHiddenUntilDelivered(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	deliver_at := strconv.FormatInt(s.now+3600, 10)
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "maintenance tonight", "0", deliver_at))
+
+	s.as(org2, "bob")
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o2")))
+	checkError(t, s.invoke("read_message", "m1"), 500, "Message does not exist")
+	checkError(t, s.invoke("ack_message", "m1", "o2"), 500, "Message does not exist")
+	checkError(t, s.invoke("getScheduledMessages", "o1"), 500, "cannot act for messenger")
+
+	s.as(org1, "alice")
+	checkIds(t, messageIds(t, s.invoke("getScheduledMessages", "o1")), "m1")
+	checkOK(t, s.invoke("read_message", "m1", "o1"))
+
+	s.now += 3601
+	s.as(org2, "bob")
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o2")), "m1")
+	s.as(org1, "alice")
+	checkIds(t, messageIds(t, s.invoke("getScheduledMessages", "o1")))
+}
+
+// ============================================================================================================================
+// Verify conversation - a chain of untouched messages verifies, tampering and deletions are reported
+// ============================================================================================================================
+type conversationVerification struct {
+	Length int  `json:"length"`
+	Valid  bool `json:"valid"`
+	Issues []struct {
+		Seq     int    `json:"seq"`
+		Problem string `json:"problem"`
+	} `json:"issues"`
+}
+
+func conversationOf(t *testing.T, s *testStub, args ...string) conversationVerification {
+	t.Helper()
+	res := s.invoke("verifyConversation", args...)
+	checkOK(t, res)
+	var verification conversationVerification
+	json.Unmarshal(res.Payload, &verification)
+	return verification
+}
+
+func TestVerifyConversationChain(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "one"))
+	checkOK(t, s.send(org2, "m2", "o2", "o1", "two"))
+	checkOK(t, s.send(org1, "m3", "o1", "o2", "three"))
+
+	if s.message(t, "m2").PrevHash != s.message(t, "m1").Hash || s.message(t, "m3").PrevHash != s.message(t, "m2").Hash {
+		t.Fatalf("messages are not chained")
+	}
+	verification := conversationOf(t, s, "o2", "o1")
+	if !verification.Valid || verification.Length != 3 {
+		t.Fatalf("expected a valid chain of 3, got %+v", verification)
+	}
+
+	tampered := s.message(t, "m2")
+	tampered.ContentHash = s.message(t, "m1").ContentHash
+	tamperedAsBytes, _ := json.Marshal(tampered)
+	s.MockStub.State["m2"] = tamperedAsBytes
+	verification = conversationOf(t, s, "o1", "o2")
+	if verification.Valid || len(verification.Issues) != 1 || verification.Issues[0].Seq != 2 ||
+		!strings.Contains(verification.Issues[0].Problem, "hash does not match") {
+		t.Fatalf("expected a mismatch at 2, got %+v", verification)
+	}
+}
+
+func TestVerifyConversationReportsDeletedLinks(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "one"))
+	checkOK(t, s.send(org1, "m2", "o1", "o2", "two"))
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("delete_message", "m1", "o1"))
+
+	verification := conversationOf(t, s, "o1", "o2")
+	if verification.Valid || len(verification.Issues) != 1 || verification.Issues[0].Seq != 1 ||
+		!strings.Contains(verification.Issues[0].Problem, "gap, message was removed") {
+		t.Fatalf("expected a gap at 1, got %+v", verification)
+	}
+}
+
+// ============================================================================================================================
+// Export mailbox - pages through inbox then outbox, the manifest hash is over the bundle and stable across exports
+// ============================================================================================================================
+type mailboxExport struct {
+	Bundle   json.RawMessage `json:"bundle"`
+	Manifest struct {
+		Sha256       string `json:"sha256"`
+		MessageCount int    `json:"message_count"`
+		ReceiptCount int    `json:"receipt_count"`
+	} `json:"manifest"`
+	Export struct {
+		ExportedAt   int64  `json:"exported_at"`
+		NextBookmark string `json:"next_bookmark"`
+	} `json:"export"`
+}
+
+func exportOf(t *testing.T, s *testStub, args ...string) (mailboxExport, []string) {
+	t.Helper()
+	res := s.invoke("exportMailbox", args...)
+	checkOK(t, res)
+	var export mailboxExport
+	json.Unmarshal(res.Payload, &export)
+	var bundle struct {
+		Messages []struct {
+			Box     string  `json:"box"`
+			Message Message `json:"message"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(export.Bundle, &bundle)
+	ids := []string{}
+	for _, exported := range bundle.Messages {
+		ids = append(ids, exported.Box+":"+exported.Message.Id)
+	}
+	return export, ids
+}
+
+func TestExportMailboxPages(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "one"))
+	checkOK(t, s.send(org1, "m2", "o1", "o2", "two"))
+	checkOK(t, s.send(org2, "m3", "o2", "o1", "three"))
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("ack_message", "m1", "o2"))
+
+	first, ids := exportOf(t, s, "o2", "2")
+	checkIds(t, ids, "inbox:m1", "inbox:m2")
+	if first.Export.NextBookmark != "outbox:" || first.Manifest.MessageCount != 2 || first.Manifest.ReceiptCount != 1 {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+	sum := sha256.Sum256(first.Bundle)
+	if first.Manifest.Sha256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("manifest hash is not over the bundle")
+	}
+
+	second, ids := exportOf(t, s, "o2", "2", first.Export.NextBookmark)
+	checkIds(t, ids, "outbox:m3")
+	if second.Export.NextBookmark != "" {
+		t.Fatalf("expected the last page, got bookmark %s", second.Export.NextBookmark)
+	}
+
+	s.now += 60
+	again, _ := exportOf(t, s, "o2", "2")
+	if again.Manifest.Sha256 != first.Manifest.Sha256 || again.Export.ExportedAt == first.Export.ExportedAt {
+		t.Fatalf("re-exporting an unchanged mailbox changed its hash")
+	}
+}
+
+func TestExportMailboxRefusals(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "one"))
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("exportMailbox", "o2", "10"), 500, "cannot act for messenger")
+	checkError(t, s.invoke("exportMailbox", "o1", "0"), 500, "between 1 and 100")
+	checkError(t, s.invoke("exportMailbox", "o1", "10", "drafts:m1"), 500, "bookmark from a previous page")
+}
@@ -70,10 +70,12 @@ func write(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 //
 // Shows Off DelState() - "removing"" a key/value from the ledger
 //
+// The sender can delete their own messages, an org admin of the sender's company can delete any of its members' messages
+//
 // Inputs - Array of strings
 //      0      ,         1
-//     id      ,  authed_by_company
-// "m999999999", "united messages"
+//     id      ,  messenger id
+// "m999999999", "o99999999999"
 // ============================================================================================================================
 func delete_message(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
 	fmt.Println("starting delete_message")
@@ -89,7 +91,7 @@ func delete_message(stub shim.ChaincodeStubInterface, args []string) (pb.Respons
 	}
 
 	id := args[0]
-	authed_by_company := args[1]
+	messenger_id := args[1]
 
 	// get the message
 	message, err := get_message(stub, id)
@@ -98,15 +100,25 @@ func delete_message(stub shim.ChaincodeStubInterface, args []string) (pb.Respons
 		return shim.Error(err.Error())
 	}
 
-	// check authorizing company (see note in set_messenger() about how this is quirky)
-	if message.Messenger.Company != authed_by_company{
-		return shim.Error("The company '" + authed_by_company + "' cannot authorize deletion for '" + message.Messenger.Company + "'.")
+	// check the deleting messenger's company, the caller's org
+	messenger, err := get_acting_messenger(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if message.Sender.Id != messenger.Id && !is_org_admin(stub, message.Sender.Company) {
+		return shim.Error("The messenger '" + messenger.Id + "' of '" + messenger.Company + "' cannot authorize deletion for '" + message.Sender.Company + "'.")
 	}
 
 	// remove the message
-	err = stub.DelState(id)                                                 //remove the key from chaincode state
+	err = remove_message(stub, message)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// let the recipient (or the group's members) know
+	err = set_message_event(stub, "delete", message, message.Recipient.Id)
 	if err != nil {
-		return shim.Error("Failed to delete state")
+		return shim.Error(err.Error())
 	}
 
 	fmt.Println("- end delete_message")
@@ -116,19 +128,35 @@ func delete_message(stub shim.ChaincodeStubInterface, args []string) (pb.Respons
 // ============================================================================================================================
 // Init Message - create a new message, store into chaincode state
 //
-// Shows off building a key's JSON value manually
+// Shows off PutPrivateData() - the text goes to the collection of the sender/recipient org pair, the channel only gets its hash
 //
 // Inputs - Array of strings
-//      0      ,    1  ,      2  ,           3         ,       4
-//     id      ,  text, ,  priority ,  messenger id    ,  recipient id
-// "m999999999", "hi !",   "1",      "o9999999999999", "o9999999999999"
+//      0      ,     1    ,          2      ,         3       ,         4            ,         5
+//     id      , priority ,   messenger id  ,   recipient id  , expires at (optional), deliver at (optional)
+// "m999999999",    "1"   , "o9999999999999", "o9999999999999",   "1490985296"       ,   "1490900000"
+//
+// An expires at of "0" is the same as leaving it out. with a deliver at in the future the message is scheduled,
+// inboxes hide it until then and the sender can still cancel it
+//
+// The messenger must belong to the caller's org, the collection is the one of the sender's and recipient's companies
+//
+// The recipient can be a group id, the message is then stored once and indexed in every current member's inbox
+//
+// A recipient that blocked the sender, or does not allow them, is refused with status BLOCKED. group members that
+// would refuse the sender are skipped. a sender or recipient that does not exist is refused with status NOT_FOUND
+//
+// A sender over their rate limit from the config is refused with status RATE_LIMITED
+//
+// Without an expiry the recipient's retention, or the channel default retention, from the config applies from delivery
+//
+// Transient - "text": "hi !", "salt": 16 or more random bytes
 // ============================================================================================================================
 func init_message(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
 	var err error
 	fmt.Println("starting init_message")
 
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+	if len(args) < 4 || len(args) > 6 {
+		return shim.Error("Incorrect number of arguments. Expecting 4 to 6")
 	}
 
 	//input sanitation
@@ -138,47 +166,202 @@ func init_message(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 	}
 
 	id := args[0]
-	text := args[1]
-	messenger_id := args[3]
-	// recipient_id := args[4]
-	priority, err := strconv.Atoi(args[2])
+	messenger_id := args[2]
+	recipient_id := args[3]
+	priority, err := strconv.Atoi(args[1])
 	if err != nil {
-		return shim.Error("3rd argument must be a numeric string")
+		return shim.Error("2nd argument must be a numeric string")
+	}
+	var expires_at, deliver_at int64
+	if len(args) >= 5 {
+		expires_at, err = strconv.ParseInt(args[4], 10, 64)
+		if err != nil {
+			return shim.Error("5th argument must be a numeric string")
+		}
+	}
+	if len(args) == 6 {
+		deliver_at, err = strconv.ParseInt(args[5], 10, 64)
+		if err != nil {
+			return shim.Error("6th argument must be a numeric string")
+		}
+	}
+
+	//get the text, it is never passed as an argument so it stays out of the transaction
+	text, salt, err := get_transient_text(stub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	//check if new messenger exists
+	var message Message
 	messenger, err := get_messenger(stub, messenger_id)
 	if err != nil {
 		fmt.Println("Failed to find messenger - " + messenger_id)
+		return error_response(NOT_FOUND, err.Error())
+	}
+	err = check_messenger_org(stub, messenger)
+	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	//check authorizing company (see note in set_messenger() about how this is quirky)
-	// if messenger.Company != authed_by_company{
-	// 	return shim.Error("The company '" + authed_by_company + "' cannot authorize creation for '" + messenger.Company + "'.")
-	// }
-
-	//check if message id already exists
-	message, err := get_message(stub, id)
+	//check if recipient exists, either a messenger or a group
+	var inboxes []string
+	recipient, err := get_messenger(stub, recipient_id)
 	if err == nil {
-		fmt.Println("This message already exists - " + id)
-		fmt.Println(message)
-		return shim.Error("This message already exists - " + id)  //all stop a message by this id exists
-	}
-
-	//build the message json string manually
-	// "company": "` + messenger.Company + `"
-	str := `{
-		"docType":"message",
-		"id": "` + id + `",
-		"text": "` + text + `",
-		"priority": ` + strconv.Itoa(priority) + `,
-		"messenger": {
-			"id": "` + messenger_id + `",
-			"username": "` + messenger.Username + `"
+		if !accepts_messages_from(recipient, messenger.Id) {
+			return error_response(BLOCKED, "The messenger '" + recipient.Id + "' does not accept messages from '" + messenger.Id + "'.")
+		}
+		inboxes = []string{recipient.Id}
+	} else {
+		group, err := get_group(stub, recipient_id)
+		if err != nil {
+			fmt.Println("Failed to find recipient - " + recipient_id)
+			return error_response(NOT_FOUND, "Recipient does not exist - " + recipient_id)
+		}
+
+		members, err := get_group_members(stub, group.Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		for _, member := range members {
+			if member.Id == messenger.Id {                       //don't deliver to yourself
+				continue
+			}
+			member_messenger, err := get_messenger(stub, member.Id)
+			if err != nil || !accepts_messages_from(member_messenger, messenger.Id) {
+				continue                                         //gone, or doesn't want it
+			}
+			if member_messenger.Company != group.Org && member_messenger.Company != messenger.Company {
+				continue                                         //can't read the collection, see add_group_member()
+			}
+			inboxes = append(inboxes, member.Id)
+		}
+
+		recipient.Id = group.Id
+		recipient.Username = group.Name
+		recipient.Company = group.Org
+		message.ToGroup = true
+		message.DeliveredTo = inboxes
+	}
+
+	//check if the id is taken, by a message or anything else
+	err = check_id_free(stub, id)
+	if err != nil {
+		fmt.Println("This id already exists - " + id)
+		return shim.Error(err.Error())                           //all stop something by this id exists
+	}
+
+	//build the message
+	message.ObjectType = "message"
+	message.Id = id
+	message.TextHash = text_hash(salt, text)
+	message.Priority = priority
+	message.Sender.Id = messenger.Id
+	message.Sender.Username = messenger.Username
+	message.Sender.Company = messenger.Company
+	message.Recipient.Id = recipient.Id
+	message.Recipient.Username = recipient.Username
+	message.Recipient.Company = recipient.Company
+	message.Collection, message.Orgs = collection_name(messenger.Company, recipient.Company)
+	message.SentAt, err = get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := get_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//the sender must have sends left in this window
+	err = count_send(stub, config, messenger.Id, message.SentAt)
+	if err != nil {
+		return error_response(RATE_LIMITED, err.Error())
+	}
+
+	//scheduled for later, a deliver at in the past is just delivered now
+	if deliver_at > message.SentAt {
+		message.DeliverAt = deliver_at
+	}
+
+	//no expiry given, fall back to the retention policy
+	if expires_at == 0 {
+		retention, ok := config.Retention[recipient.Id]
+		if !ok {
+			retention = config.DefaultRetention
+		}
+		if retention > 0 {
+			expires_at = delivered_at(message) + retention
+		}
+	} else if expires_at <= delivered_at(message) {
+		return shim.Error("Message would already be expired - " + args[4])
+	}
+	message.ExpiresAt = expires_at
+
+	err = chain_message(stub, &message)                          //link it to the end of its conversation
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = put_message_text(stub, message, text, salt)            //store the text in the private collection
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	secret, err := get_search_secret(stub, message.Collection, salt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = index_message_terms(stub, secret, id, text, false)     //make it searchable
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	messageAsBytes, _ := json.Marshal(message)                   //convert to array of bytes
+	err = stub.PutState(id, messageAsBytes)                      //store message with id as key
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//index the message in the sender's outbox
+	outboxKey, err := outbox_key(stub, messenger.Id, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(outboxKey, []byte{0x00})                 //the key is the index, value is unused
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//index the message by expiry, for sweep_expired()
+	if message.ExpiresAt != 0 {
+		expiryKey, err := expiry_key(stub, message.ExpiresAt, id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.PutState(expiryKey, []byte{0x00})             //the key is the index, value is unused
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	//index the message in the recipient's inbox, or each member's inbox
+	for _, inbox := range inboxes {
+		inboxKey, err := inbox_key(stub, inbox, id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.PutState(inboxKey, []byte{0x00})              //the key is the index, value is unused
+		if err != nil {
+			return shim.Error(err.Error())
 		}
-	}`
-	err = stub.PutState(id, []byte(str))                         //store message with id as key
+	}
+
+	//let the recipient (or the group's members) know, a scheduled message only tells the sender
+	if message.DeliverAt != 0 {
+		err = set_message_event(stub, "scheduled", message, messenger.Id)
+	} else {
+		err = set_message_event(stub, "sent", message, recipient.Id)
+	}
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -192,10 +375,12 @@ func init_message(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 //
 // Shows off building key's value from GoLang Structure
 //
+// The messenger's company is the msp id of the caller's org
+//
 // Inputs - Array of Strings
-//           0     ,     1   ,   2
-//      messenger id   , username, company
-// "o9999999999999",     bob", "united messages"
+//           0     ,     1
+//      messenger id   , username
+// "o9999999999999",     bob"
 // ============================================================================================================================
 func init_messenger(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
@@ -215,14 +400,22 @@ func init_messenger(stub shim.ChaincodeStubInterface, args []string) pb.Response
 	messenger.ObjectType = "message_messenger"
 	messenger.Id =  args[0]
 	messenger.Username = strings.ToLower(args[1])
-	// messenger.Company = args[2]
+	messenger.Company, err = get_creator_msp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	fmt.Println(messenger)
 
-	//check if user already exists
-	_, err = get_messenger(stub, messenger.Id)
-	if err == nil {
-		fmt.Println("This messenger already exists - " + messenger.Id)
-		return shim.Error("This messenger already exists - " + messenger.Id)
+	err = check_conversation_party_id(messenger.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//check if the id is taken, by a messenger or anything else
+	err = check_id_free(stub, messenger.Id)
+	if err != nil {
+		fmt.Println("This id already exists - " + messenger.Id)
+		return shim.Error(err.Error())
 	}
 
 	//store user
@@ -237,6 +430,59 @@ func init_messenger(stub shim.ChaincodeStubInterface, args []string) pb.Response
 	return shim.Success(nil)
 }
 
+// ============================================================================================================================
+// Update Messenger - update a profile field of a messenger, only the messenger's own org can
+//
+// Inputs - Array of Strings
+//           0     ,      1      ,      2
+//      messenger id   ,    field    ,    value
+// "o9999999999999", "display_name", "Bob B."
+//
+// field is one of display_name, contact or public_key. value may be up to 4096 characters, "" clears the field
+// ============================================================================================================================
+func update_messenger(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting update_messenger")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	//input sanitation, the value is free form so it gets its own check
+	err = sanitize_arguments(args[:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var field = args[1]
+	var value = args[2]
+	if len(value) > 4096 {
+		return shim.Error("Argument 2 must be <= 4096 characters")
+	}
+
+	messenger, err := get_acting_messenger(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if field == "display_name" {
+		messenger.DisplayName = value
+	} else if field == "contact" {
+		messenger.Contact = value
+	} else if field == "public_key" {
+		messenger.PublicKey = value
+	} else {
+		return shim.Error("2nd argument must be 'display_name', 'contact' or 'public_key'")
+	}
+
+	err = put_messenger(stub, messenger)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end update_messenger")
+	return shim.Success(nil)
+}
+
 // ============================================================================================================================
 // Set Messenger on Message
 //
@@ -303,3 +549,1295 @@ func init_messenger(stub shim.ChaincodeStubInterface, args []string) pb.Response
 // 	fmt.Println("- end set messenger")
 // 	return shim.Success(nil)
 // }
+
+// ============================================================================================================================
+// Ack Message - recipient acknowledges a message, store a receipt
+//
+// Inputs - Array of Strings
+//       0      ,        1
+//  message id  ,  recipient id
+// "m999999999", "o99999999999"
+// ============================================================================================================================
+func ack_message(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting ack_message")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var message_id = args[0]
+	var messenger_id = args[1]
+
+	message, err := get_live_message(stub, message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	messenger, err := get_acting_messenger(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only a recipient can acknowledge
+	if !is_recipient(message, messenger.Id) {
+		return shim.Error("The messenger '" + messenger.Id + "' is not the recipient of message '" + message.Id + "'.")
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if is_pending(message, now) {
+		return shim.Error("Message does not exist - " + message.Id)   //recipients don't see it until it is delivered
+	}
+
+	// acknowledging twice keeps the first time
+	receipt, err := get_receipt(stub, message.Id, messenger.Id)
+	if err == nil && receipt.AckedAt != 0 {
+		return shim.Error("This message was already acknowledged - " + message.Id)
+	}
+
+	receipt.ObjectType = "message_receipt"
+	receipt.MessageId = message.Id
+	receipt.Messenger.Id = messenger.Id
+	receipt.Messenger.Username = messenger.Username
+	receipt.Messenger.Company = messenger.Company
+	receipt.AckedAt = now
+	if receipt.ReadAt == 0 {                         //acknowledging is reading too
+		receipt.ReadAt = now
+	}
+	err = put_receipt(stub, receipt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// let the sender know
+	err = set_message_event(stub, "ack", message, message.Sender.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end ack_message")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Mark Read - recipient marks a message as read, the receipt records when
+//
+// Inputs - Array of Strings
+//       0      ,        1
+//  message id  ,  recipient id
+// "m999999999", "o99999999999"
+// ============================================================================================================================
+func mark_read(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting mark_read")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var message_id = args[0]
+	var messenger_id = args[1]
+
+	message, err := get_live_message(stub, message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	messenger, err := get_acting_messenger(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only a recipient can read
+	if !is_recipient(message, messenger.Id) {
+		return shim.Error("The messenger '" + messenger.Id + "' is not the recipient of message '" + message.Id + "'.")
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if is_pending(message, now) {
+		return shim.Error("Message does not exist - " + message.Id)   //recipients don't see it until it is delivered
+	}
+
+	receipt, err := get_receipt(stub, message.Id, messenger.Id)
+	if err == nil && receipt.ReadAt != 0 {
+		return shim.Error("This message was already read - " + message.Id)
+	}
+
+	receipt.ObjectType = "message_receipt"
+	receipt.MessageId = message.Id
+	receipt.Messenger.Id = messenger.Id
+	receipt.Messenger.Username = messenger.Username
+	receipt.Messenger.Company = messenger.Company
+	receipt.ReadAt = now
+	err = put_receipt(stub, receipt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// let the sender know
+	err = set_message_event(stub, "read", message, message.Sender.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end mark_read")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Escalate Message - raise the priority of a message and record who did it
+//
+// Inputs - Array of Strings
+//       0     ,        1       ,      2
+//  message id , escalated by id, new priority
+// "m999999999", "o99999999999" ,     "3"
+// ============================================================================================================================
+func escalate_message(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting escalate_message")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var message_id = args[0]
+	var messenger_id = args[1]
+	priority, err := strconv.Atoi(args[2])
+	if err != nil {
+		return shim.Error("3rd argument must be a numeric string")
+	}
+
+	message, err := get_live_message(stub, message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	messenger, err := get_acting_messenger(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only the two parties of the message can escalate it, and recipients only once it is delivered
+	if message.Sender.Id != messenger.Id && !is_recipient(message, messenger.Id) {
+		return shim.Error("The messenger '" + messenger.Id + "' cannot escalate message '" + message.Id + "'.")
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if message.Sender.Id != messenger.Id && is_pending(message, now) {
+		return shim.Error("Message does not exist - " + message.Id)
+	}
+	if priority <= message.Priority {
+		return shim.Error("New priority must be higher than the current priority " + strconv.Itoa(message.Priority))
+	}
+
+	var escalation Escalation
+	escalation.By.Id = messenger.Id
+	escalation.By.Username = messenger.Username
+	escalation.By.Company = messenger.Company
+	escalation.From = message.Priority
+	escalation.To = priority
+	escalation.At = now
+
+	// escalate the message
+	message.Priority = priority
+	message.Escalations = append(message.Escalations, escalation)
+	messageAsBytes, _ := json.Marshal(message)       //convert to array of bytes
+	err = stub.PutState(message.Id, messageAsBytes)  //rewrite the message with id as key
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end escalate_message")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Priority SLA - admin sets how many seconds a message of a priority may go unacknowledged before it is overdue
+//
+// Inputs - Array of Strings
+//      0    ,    1
+//  priority , seconds
+//    "3"    , "3600"
+// ============================================================================================================================
+func set_priority_sla(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_priority_sla")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	priority, err := strconv.Atoi(args[0])
+	if err != nil {
+		return shim.Error("1st argument must be a numeric string")
+	}
+	seconds, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || seconds <= 0 {
+		return shim.Error("2nd argument must be a positive numeric string")
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := get_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config.PrioritySLA[strconv.Itoa(priority)] = seconds
+	err = put_config(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_priority_sla")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Sweep Expired - admin removes up to a batch of expired messages, leaving a tombstone for each
+//
+// Inputs - Array of Strings
+//       0
+//   batch size
+//     "50"
+//
+// Returns - ids of the swept messages, sweep again while this is a full batch
+// ============================================================================================================================
+func sweep_expired(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	var swept []string
+	fmt.Println("starting sweep_expired")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	batch, err := strconv.Atoi(args[0])
+	if err != nil || batch <= 0 || batch > 100 {
+		return shim.Error("1st argument must be a numeric string between 1 and 100")
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the expiry index is oldest first, so only expired messages, plus the one after them, are ever scanned
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("expiry~message", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() && len(swept) < batch {
+		key, _, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keys, err := stub.SplitCompositeKey(key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		expires_at, _ := strconv.ParseInt(keys[0], 10, 64)
+		if expires_at > now {
+			break                                        //everything after this expires later
+		}
+
+		message, err := get_message(stub, keys[1])
+		if err != nil || message.ExpiresAt != expires_at {
+			err = stub.DelState(key)                     //stale entry, the message is gone or was replaced
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			continue
+		}
+
+		err = remove_message(stub, message)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// leave a tombstone saying why it is gone
+		err = put_tombstone(stub, message, "expired", now)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		swept = append(swept, message.Id)
+	}
+
+	fmt.Println("- end sweep_expired")
+	sweptAsBytes, _ := json.Marshal(swept)               //convert to array of bytes
+	return shim.Success(sweptAsBytes)
+}
+
+// ============================================================================================================================
+// Set Retention - admin sets how many seconds messages live when sent without an expiry
+//
+// Inputs - Array of Strings
+//         0           ,    1
+//  messenger id or "*", seconds
+//  "o99999999999"     , "86400"
+//
+// "*" sets the channel wide default, "0" seconds removes a messenger's override (or the default)
+// ============================================================================================================================
+func set_retention(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_retention")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var messenger_id = args[0]
+	seconds, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || seconds < 0 {
+		return shim.Error("2nd argument must be a non-negative numeric string")
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := get_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if messenger_id == "*" {
+		config.DefaultRetention = seconds
+	} else if seconds == 0 {
+		delete(config.Retention, messenger_id)
+	} else {
+		_, err = get_messenger(stub, messenger_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		config.Retention[messenger_id] = seconds
+	}
+
+	err = put_config(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_retention")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Init Group - create a new group, the creating messenger is its first admin and member
+//
+// Inputs - Array of Strings
+//       0     ,      1      ,        2
+//   group id  ,    name     ,   admin id
+// "g999999999", "dispatch"  , "o99999999999"
+// ============================================================================================================================
+func init_group(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting init_group")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var group Group
+	group.ObjectType = "message_group"
+	group.Id = args[0]
+	group.Name = strings.ToLower(args[1])
+	var admin_id = args[2]
+
+	err = check_conversation_party_id(group.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check if the id is taken, by a group or anything else
+	err = check_id_free(stub, group.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	admin, err := get_acting_messenger(stub, admin_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	group.Org, err = get_creator_msp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	group.Admins = []MessengerRelation{{Id: admin.Id, Username: admin.Username, Company: admin.Company}}
+
+	// store group, and its admin as the first member
+	groupAsBytes, _ := json.Marshal(group)                   //convert to array of bytes
+	err = stub.PutState(group.Id, groupAsBytes)              //store group by its Id
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_group_member(stub, group.Id, admin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end init_group")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Add Group Member - a group admin adds a messenger to the group, optionally as another admin
+//
+// Inputs - Array of Strings
+//       0     ,      1        ,        2       ,        3
+//   group id  ,   member id   ,    admin id    , "admin" (optional)
+// "g999999999", "o99999999999", "o99999999999" ,     "admin"
+//
+// Members must belong to the group's org. a group message's text lives in the collection of the sender's org and the
+// group's org, so a member of any third org could never read it
+// ============================================================================================================================
+func add_group_member(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting add_group_member")
+
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or 4")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var group_id = args[0]
+	var member_id = args[1]
+	var admin_id = args[2]
+	var as_admin = len(args) == 4 && args[3] == "admin"
+
+	group, err := get_group(stub, group_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = get_acting_messenger(stub, admin_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !is_group_admin(group, admin_id) {
+		return shim.Error("The messenger '" + admin_id + "' is not an admin of group '" + group.Id + "'.")
+	}
+
+	member, err := get_messenger(stub, member_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if member.Company != group.Org {
+		return shim.Error("The messenger '" + member.Id + "' of '" + member.Company + "' cannot join a group of '" + group.Org + "'.")
+	}
+
+	err = put_group_member(stub, group.Id, member)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// promote to admin
+	if as_admin && !is_group_admin(group, member.Id) {
+		group.Admins = append(group.Admins, MessengerRelation{Id: member.Id, Username: member.Username, Company: member.Company})
+		groupAsBytes, _ := json.Marshal(group)               //convert to array of bytes
+		err = stub.PutState(group.Id, groupAsBytes)          //rewrite the group with id as key
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end add_group_member")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Remove Group Member - a group admin removes a messenger from the group, messages already delivered stay delivered
+//
+// Inputs - Array of Strings
+//       0     ,      1        ,        2
+//   group id  ,   member id   ,    admin id
+// "g999999999", "o99999999999", "o99999999999"
+// ============================================================================================================================
+func remove_group_member(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting remove_group_member")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var group_id = args[0]
+	var member_id = args[1]
+	var admin_id = args[2]
+
+	group, err := get_group(stub, group_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = get_acting_messenger(stub, admin_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !is_group_admin(group, admin_id) {
+		return shim.Error("The messenger '" + admin_id + "' is not an admin of group '" + group.Id + "'.")
+	}
+
+	// an admin being removed loses admin too, but the group must keep one
+	var admins []MessengerRelation
+	for _, admin := range group.Admins {
+		if admin.Id != member_id {
+			admins = append(admins, admin)
+		}
+	}
+	if len(admins) == 0 {
+		return shim.Error("Cannot remove the last admin of group '" + group.Id + "'.")
+	}
+
+	memberKey, err := group_member_key(stub, group.Id, member_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(memberKey)
+	if err != nil {
+		return shim.Error("Failed to delete group member")
+	}
+
+	if len(admins) != len(group.Admins) {
+		group.Admins = admins
+		groupAsBytes, _ := json.Marshal(group)               //convert to array of bytes
+		err = stub.PutState(group.Id, groupAsBytes)          //rewrite the group with id as key
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end remove_group_member")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Attach Marble - the sender references a marble from a message, snapshotting the marble's version and owner
+//
+// Inputs - Array of Strings
+//       0     ,       1       ,          2
+//  message id ,   sender id   ,      marble id
+// "m999999999", "o99999999999", "m01490985296352SjAyM"
+// ============================================================================================================================
+func attach_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting attach_marble")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var message_id = args[0]
+	var messenger_id = args[1]
+	var marble_id = args[2]
+
+	message, err := get_live_message(stub, message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only the sender can attach marbles
+	_, err = get_acting_messenger(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if message.Sender.Id != messenger_id {
+		return shim.Error("The messenger '" + messenger_id + "' is not the sender of message '" + message.Id + "'.")
+	}
+	for _, attached := range message.Marbles {
+		if attached.Id == marble_id {
+			return shim.Error("This marble is already attached - " + marble_id)
+		}
+	}
+
+	ref, err := get_marble_ref(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ref.Id != marble_id {
+		return shim.Error("Marble does not exist - " + marble_id)
+	}
+	ref.AttachedAt, err = get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	message.Marbles = append(message.Marbles, ref)
+	messageAsBytes, _ := json.Marshal(message)       //convert to array of bytes
+	err = stub.PutState(message.Id, messageAsBytes)  //rewrite the message with id as key
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end attach_marble")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Edit Message - the sender replaces a message's text, the prior text is kept as a revision
+//
+// Inputs - Array of Strings
+//       0     ,       1
+//  message id ,   editor id
+// "m999999999", "o99999999999"
+//
+// Transient - "text": "hi again !", "salt": 16 or more random bytes
+// ============================================================================================================================
+func edit_message(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting edit_message")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var message_id = args[0]
+	var messenger_id = args[1]
+
+	text, salt, err := get_transient_text(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	message, err := get_live_message(stub, message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	editor, err := get_acting_messenger(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only the sender can edit, and only within the edit window
+	if message.Sender.Id != editor.Id {
+		return shim.Error("The messenger '" + editor.Id + "' is not the sender of message '" + message.Id + "'.")
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := get_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if config.EditWindow > 0 && now - message.SentAt > config.EditWindow {
+		return shim.Error("The edit window of " + strconv.FormatInt(config.EditWindow, 10) + " seconds has passed for message '" + message.Id + "'.")
+	}
+
+	// keep the current text, and its salt, as a prior revision
+	old_text, err := get_message_text(stub, message)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if old_text == text {
+		return shim.Error("Text is unchanged for message - " + message.Id)
+	}
+	body, err := get_revision_body(stub, message, message.Revision)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	body.ObjectType = "message_revision"
+	key, err := revision_key(stub, message.Id, message.Revision)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bodyAsBytes, _ := json.Marshal(body)             //convert to array of bytes
+	err = stub.PutPrivateData(message.Collection, key, bodyAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// edit the message
+	message.Revision = message.Revision + 1
+	message.TextHash = text_hash(salt, text)
+	message.EditedAt = now
+	message.EditedBy = &MessengerRelation{Id: editor.Id, Username: editor.Username, Company: editor.Company}
+
+	err = put_message_text(stub, message, text, salt) //replace the text in the private collection
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	secret, err := get_search_secret(stub, message.Collection, salt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = index_message_terms(stub, secret, message.Id, old_text, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = index_message_terms(stub, secret, message.Id, text, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	messageAsBytes, _ := json.Marshal(message)       //convert to array of bytes
+	err = stub.PutState(message.Id, messageAsBytes)  //rewrite the message with id as key
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end edit_message")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Edit Window - admin sets how many seconds after sending a message can still be edited
+//
+// Inputs - Array of Strings
+//      0
+//   seconds
+//   "900"
+//
+// "0" removes the limit
+// ============================================================================================================================
+func set_edit_window(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_edit_window")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	seconds, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || seconds < 0 {
+		return shim.Error("1st argument must be a non-negative numeric string")
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := get_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	config.EditWindow = seconds
+	err = put_config(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_edit_window")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Block Messenger - a messenger refuses all messages from another messenger
+//
+// Inputs - Array of Strings
+//        0      ,       1
+//  messenger id ,   blocked id
+// "o99999999999", "o88888888888"
+// ============================================================================================================================
+func block_messenger(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting block_messenger")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	messenger, err := get_acting_messenger(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	blocked, err := get_messenger(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if contains(messenger.Blocked, blocked.Id) {
+		return shim.Error("This messenger is already blocked - " + blocked.Id)
+	}
+
+	messenger.Blocked = append(messenger.Blocked, blocked.Id)
+	err = put_messenger(stub, messenger)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end block_messenger")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Unblock Messenger - a messenger accepts messages from a messenger they blocked again, subject to their contact policy
+//
+// Inputs - Array of Strings
+//        0      ,       1
+//  messenger id ,   blocked id
+// "o99999999999", "o88888888888"
+// ============================================================================================================================
+func unblock_messenger(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting unblock_messenger")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	messenger, err := get_acting_messenger(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !contains(messenger.Blocked, args[1]) {
+		return shim.Error("This messenger is not blocked - " + args[1])
+	}
+
+	var blocked []string
+	for _, id := range messenger.Blocked {
+		if id != args[1] {
+			blocked = append(blocked, id)
+		}
+	}
+	messenger.Blocked = blocked
+	err = put_messenger(stub, messenger)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end unblock_messenger")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Contact Policy - a messenger accepts messages from anyone ("open") or only from an allow list ("allow_list")
+//
+// Inputs - Array of Strings
+//        0      ,      1      ,       2...
+//  messenger id ,    policy   ,   allowed ids (replaces the allow list)
+// "o99999999999", "allow_list", "o88888888888", "o77777777777"
+// ============================================================================================================================
+func set_contact_policy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_contact_policy")
+
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var policy = args[1]
+	if policy != "open" && policy != "allow_list" {
+		return shim.Error("2nd argument must be 'open' or 'allow_list'")
+	}
+
+	messenger, err := get_acting_messenger(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var allowed []string
+	for _, id := range args[2:] {
+		_, err = get_messenger(stub, id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		allowed = append(allowed, id)
+	}
+
+	messenger.ContactPolicy = policy
+	messenger.AllowList = allowed
+	err = put_messenger(stub, messenger)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_contact_policy")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Rate Limit - admin sets how many messages may be sent per window, channel wide or as an override for one messenger
+//
+// Inputs - Array of Strings
+//         0           ,   1  ,    2
+//  messenger id or "*", count, window seconds
+//  "o99999999999"     , "100",   "3600"
+//
+// "*" sets the channel wide default, a count of "0" removes a messenger's override (or the default limit)
+// ============================================================================================================================
+func set_rate_limit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_rate_limit")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var messenger_id = args[0]
+	var limit RateLimit
+	limit.Count, err = strconv.Atoi(args[1])
+	if err != nil || limit.Count < 0 {
+		return shim.Error("2nd argument must be a non-negative numeric string")
+	}
+	limit.Window, err = strconv.ParseInt(args[2], 10, 64)
+	if err != nil || limit.Window <= 0 {
+		return shim.Error("3rd argument must be a positive numeric string")
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := get_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if messenger_id == "*" {
+		config.RateLimit = limit
+	} else if limit.Count == 0 {
+		delete(config.RateLimits, messenger_id)
+	} else {
+		_, err = get_messenger(stub, messenger_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		config.RateLimits[messenger_id] = limit
+	}
+
+	err = put_config(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_rate_limit")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Cancel Scheduled Message - the sender cancels a message before its deliver at time, leaving a tombstone
+//
+// Inputs - Array of Strings
+//       0     ,       1
+//  message id ,   sender id
+// "m999999999", "o99999999999"
+// ============================================================================================================================
+func cancel_scheduled_message(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting cancel_scheduled_message")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var message_id = args[0]
+	var messenger_id = args[1]
+
+	message, err := get_live_message(stub, message_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only the sender can cancel, and only what wasn't delivered yet
+	_, err = get_acting_messenger(stub, messenger_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if message.Sender.Id != messenger_id {
+		return shim.Error("The messenger '" + messenger_id + "' is not the sender of message '" + message.Id + "'.")
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !is_pending(message, now) {
+		return shim.Error("This message was already delivered - " + message.Id)
+	}
+
+	err = remove_message(stub, message)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_tombstone(stub, message, "cancelled", now)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end cancel_scheduled_message")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Report Message - a recipient reports a message to the moderators, the report id is this transaction's id
+//
+// Inputs - Array of Strings
+//       0     ,       1        ,     2
+//  message id ,  recipient id  ,   reason
+// "m999999999", "o99999999999" ,   "spam"
+//
+// reason may be up to 256 characters
+// ============================================================================================================================
+func report_message(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting report_message")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation, the reason is free form so it gets its own check
+	err = sanitize_arguments(args[:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var reason = args[2]
+	if len(reason) == 0 || len(reason) > 256 {
+		return shim.Error("Argument 2 must be a non-empty string <= 256 characters")
+	}
+
+	message, err := get_live_message(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	messenger, err := get_acting_messenger(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// only a recipient can report
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !is_recipient(message, messenger.Id) || is_pending(message, now) {
+		return shim.Error("The messenger '" + messenger.Id + "' is not the recipient of message '" + message.Id + "'.")
+	}
+
+	var report Report
+	report.ObjectType = "message_report"
+	report.Id = stub.GetTxID()
+	report.MessageId = message.Id
+	report.Reporter = MessengerRelation{Id: messenger.Id, Username: messenger.Username, Company: messenger.Company}
+	report.Reason = reason
+	report.Status = "open"
+	report.ReportedAt = now
+
+	err = put_report(stub, report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_moderation_action(stub, "report", report, reason, now)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end report_message")
+	return shim.Success([]byte(report.Id))
+}
+
+// ============================================================================================================================
+// Hide Message - admin hides the message of an open report, it stays on the ledger but out of inboxes and searches
+//
+// Inputs - Array of Strings
+//       0     ,     1
+//   report id ,   reason
+//  "9a8b7c..." , "abusive"
+//
+// reason may be up to 256 characters
+// ============================================================================================================================
+func hide_message(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return resolve_report(stub, args, "hide")
+}
+
+// ============================================================================================================================
+// Dismiss Report - admin closes an open report without acting on its message
+//
+// Inputs - Array of Strings
+//       0     ,     1
+//   report id ,   reason
+//  "9a8b7c..." , "not abusive"
+//
+// reason may be up to 256 characters
+// ============================================================================================================================
+func dismiss_report(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return resolve_report(stub, args, "dismiss")
+}
+
+// ============================================================================================================================
+// Resolve Report - close an open report by hiding its message or dismissing it, and record the moderation action
+// ============================================================================================================================
+func resolve_report(stub shim.ChaincodeStubInterface, args []string, action string) pb.Response {
+	var err error
+	fmt.Println("starting resolve_report - " + action)
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation, report ids are tx ids and the reason is free form, so they get their own checks
+	var report_id = args[0]
+	var reason = args[1]
+	if len(report_id) == 0 || len(report_id) > 64 {
+		return shim.Error("Argument 0 must be a non-empty string <= 64 characters")
+	}
+	if len(reason) == 0 || len(reason) > 256 {
+		return shim.Error("Argument 1 must be a non-empty string <= 256 characters")
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	report, err := get_report(stub, report_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if report.Status != "open" {
+		return shim.Error("This report was already resolved - " + report.Id)
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if action == "hide" {
+		message, err := get_message(stub, report.MessageId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		message.Hidden = true
+		messageAsBytes, _ := json.Marshal(message)   //convert to array of bytes
+		err = stub.PutState(message.Id, messageAsBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		report.Status = "hidden"
+	} else {
+		report.Status = "dismissed"
+	}
+
+	report.ResolvedAt = now
+	err = put_report(stub, report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_moderation_action(stub, action, report, reason, now)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end resolve_report - " + action)
+	return shim.Success(nil)
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ============================================================================================================================
+// Private Data - message text only goes to the org pair's collection, the channel only gets its salted hash
+// ============================================================================================================================
+func TestInitMessageStoresTextInCollection(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "meet at noon"))
+
+	message := s.message(t, "m1")
+	if message.Text != "" {
+		t.Fatalf("text went on the channel")
+	}
+	if message.Collection != "collectionOrg1MSPOrg2MSP" {
+		t.Fatalf("wrong collection %s", message.Collection)
+	}
+	var body MessageBody
+	json.Unmarshal(s.private[message.Collection]["m1"], &body)
+	if body.Text != "meet at noon" {
+		t.Fatalf("text not in the collection")
+	}
+	salt := hex.EncodeToString([]byte("salt-of-m1-0123456789"))
+	if body.Salt != salt || message.TextHash != text_hash(salt, "meet at noon") {
+		t.Fatalf("text hash is not over the salt and text")
+	}
+}
+
+func TestInitMessageRefusesMissingSalt(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+
+	s.as(org1, "alice")
+	s.transient = map[string][]byte{"text": []byte("meet at noon")}
+	checkError(t, s.invoke("init_message", "m1", "1", "o1", "o2"), 500, "salt")
+	if s.MockStub.State["m1"] != nil {
+		t.Fatalf("message stored without a salt")
+	}
+}
+
+// ============================================================================================================================
+// Priority - escalation only raises a message's priority, only its two parties can do it, SLAs are admin only
+// ============================================================================================================================
+func TestEscalateMessage(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "ship it"))
+
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("escalate_message", "m1", "o2", "3"))
+
+	message := s.message(t, "m1")
+	if message.Priority != 3 || len(message.Escalations) != 1 || message.Escalations[0].By.Id != "o2" {
+		t.Fatalf("escalation not recorded - %+v", message)
+	}
+	checkError(t, s.invoke("escalate_message", "m1", "o2", "2"), 500, "must be higher")
+}
+
+func TestEscalateMessageRefusesOutsiders(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	s.messenger(t, org2, "o3", "carol")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "ship it"))
+
+	s.as(org2, "carol")
+	checkError(t, s.invoke("escalate_message", "m1", "o3", "3"), 500, "cannot escalate")
+}
+
+func TestSetPrioritySLARequiresAdmin(t *testing.T) {
+	s := newTestStub()
+	s.as(org1, "alice")
+	checkError(t, s.invoke("set_priority_sla", "3", "3600"), 500, "not a messaging admin")
+
+	s.admin(org1)
+	checkOK(t, s.invoke("set_priority_sla", "3", "3600"))
+}
+
+// ============================================================================================================================
+// Expiry - expired messages read as gone, the admin sweep removes them and leaves tombstones
+// ============================================================================================================================
+func TestSweepExpired(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "soon gone", strconv.FormatInt(s.now+10, 10)))
+	checkOK(t, s.send(org1, "m2", "o1", "o2", "here to stay"))
+	s.now += 11
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("sweep_expired", "10"), 500, "not a messaging admin")
+
+	s.admin(org1)
+	res := s.invoke("sweep_expired", "10")
+	checkOK(t, res)
+	if string(res.Payload) != `["m1"]` {
+		t.Fatalf("expected m1 to be swept, got %s", res.Payload)
+	}
+	if s.MockStub.State["m1"] != nil || s.MockStub.State["m2"] == nil {
+		t.Fatalf("sweep removed the wrong messages")
+	}
+	tombstoneKey, _ := s.CreateCompositeKey("tombstone", []string{"m1"})
+	var tombstone Tombstone
+	json.Unmarshal(s.MockStub.State[tombstoneKey], &tombstone)
+	if tombstone.Reason != "expired" {
+		t.Fatalf("no tombstone for m1")
+	}
+}
+
+func TestRetentionSetsExpiry(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("set_retention", "*", "100"), 500, "not a messaging admin")
+	s.admin(org1)
+	checkOK(t, s.invoke("set_retention", "*", "100"))
+
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "hi"))
+	if s.message(t, "m1").ExpiresAt != s.now+100 {
+		t.Fatalf("default retention not applied")
+	}
+	checkError(t, s.send(org1, "m2", "o1", "o2", "hi", strconv.FormatInt(s.now, 10)), 500, "already be expired")
+}
+
+// ============================================================================================================================
+// Groups - a group message goes to the inbox of every current member of the group's org, admins manage membership
+// ============================================================================================================================
+func TestGroupMessageDeliveredToMembers(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org1, "o2", "bob")
+	s.messenger(t, org1, "o3", "carol")
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("init_group", "g1", "dispatch", "o1"))
+	checkOK(t, s.invoke("add_group_member", "g1", "o2", "o1"))
+
+	checkOK(t, s.send(org1, "m1", "o1", "g1", "all hands"))
+	checkIds(t, s.message(t, "m1").DeliveredTo, "o2")
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o2")), "m1")
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o3")))
+
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("remove_group_member", "g1", "o2", "o1"))
+	checkOK(t, s.send(org1, "m2", "o1", "g1", "all hands again"))
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o2")), "m1")
+}
+
+func TestGroupMembershipRefusals(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org1, "o2", "bob")
+	s.messenger(t, org2, "o4", "dave")
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("init_group", "g1", "dispatch", "o1"))
+
+	checkError(t, s.invoke("init_group", "o2", "dispatch", "o1"), 500, "already exists")
+	checkError(t, s.invoke("add_group_member", "g1", "o4", "o1"), 500, "cannot join a group of")
+	s.as(org1, "bob")
+	checkError(t, s.invoke("add_group_member", "g1", "o2", "o2"), 500, "is not an admin of group")
+}
+
+// ============================================================================================================================
+// Marble References - a marble's version and owner are read from the marbles chaincode when attached
+// ============================================================================================================================
+
+func TestAttachMarble(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "look at this one"))
+	histories := map[string]string{
+		"marble1": `[{"txId":"mtx1","value":{"id":"marble1","owner":{"id":"o1"}}}]`,
+	}
+	s.invoked = marblesChaincode(histories)
+
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("attach_marble", "m1", "o1", "marble1"))
+	refs := s.message(t, "m1").Marbles
+	if len(refs) != 1 || refs[0].TxId != "mtx1" || refs[0].Owner.Id != "o1" {
+		t.Fatalf("marble not attached - %+v", refs)
+	}
+	checkError(t, s.invoke("attach_marble", "m1", "o1", "marble2"), 500, "Marble does not exist")
+	s.as(org2, "bob")
+	checkError(t, s.invoke("attach_marble", "m1", "o2", "marble1"), 500, "not the sender")
+}
+
+// ============================================================================================================================
+// Edits - the sender can edit within the edit window, every prior text stays readable as a revision
+// ============================================================================================================================
+func TestEditMessageKeepsRevisions(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "meet at noon"))
+
+	s.as(org1, "alice")
+	s.transient = map[string][]byte{"text": []byte("meet at one"), "salt": []byte("another-salt-0123456789")}
+	checkOK(t, s.invoke("edit_message", "m1", "o1"))
+	if s.message(t, "m1").Revision != 1 {
+		t.Fatalf("revision not counted")
+	}
+
+	s.as(org2, "bob")
+	res := s.invoke("getMessageRevisions", "m1")
+	checkOK(t, res)
+	var revisions []struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(res.Payload, &revisions)
+	if len(revisions) != 2 || revisions[0].Text != "meet at noon" || revisions[1].Text != "meet at one" {
+		t.Fatalf("expected both revisions, got %s", res.Payload)
+	}
+}
+
+func TestEditMessageRefusals(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	s.admin(org1)
+	checkOK(t, s.invoke("set_edit_window", "60"))
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "meet at noon"))
+
+	s.as(org2, "bob")
+	s.transient = map[string][]byte{"text": []byte("meet never"), "salt": []byte("another-salt-0123456789")}
+	checkError(t, s.invoke("edit_message", "m1", "o2"), 500, "not the sender")
+
+	s.now += 61
+	s.as(org1, "alice")
+	s.transient = map[string][]byte{"text": []byte("meet at one"), "salt": []byte("another-salt-0123456789")}
+	checkError(t, s.invoke("edit_message", "m1", "o1"), 500, "edit window")
+}
+
+// ============================================================================================================================
+// Blocking - a recipient refuses blocked senders, and anyone off their allow list, with status BLOCKED
+// ============================================================================================================================
+func TestBlockMessenger(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("block_messenger", "o2", "o1"))
+	checkError(t, s.send(org1, "m1", "o1", "o2", "hi"), BLOCKED, "does not accept messages")
+
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("unblock_messenger", "o2", "o1"))
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "hi"))
+
+	s.as(org1, "alice")
+	checkError(t, s.invoke("block_messenger", "o2", "o1"), 500, "cannot act for messenger")
+}
+
+func TestAllowListPolicy(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org1, "o3", "carol")
+	s.messenger(t, org2, "o2", "bob")
+
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("set_contact_policy", "o2", "allow_list", "o3"))
+	checkError(t, s.send(org1, "m1", "o1", "o2", "hi"), BLOCKED, "does not accept messages")
+	checkOK(t, s.send(org1, "m2", "o3", "o2", "hi"))
+}
+
+// ============================================================================================================================
+// Rate Limits - a sender gets Count sends per window in total, whichever counter shards their sends land in
+// ============================================================================================================================
+func TestRateLimit(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	s.as(org1, "alice")
+	checkError(t, s.invoke("set_rate_limit", "*", "3", "60"), 500, "not a messaging admin")
+	s.admin(org1)
+	checkOK(t, s.invoke("set_rate_limit", "*", "3", "60"))
+
+	for i := 1; i <= 3; i++ {
+		checkOK(t, s.send(org1, "m"+strconv.Itoa(i), "o1", "o2", "hi"))
+	}
+	checkError(t, s.send(org1, "m4", "o1", "o2", "hi"), RATE_LIMITED, "used up its sends")
+
+	s.now += 60
+	checkOK(t, s.send(org1, "m4", "o1", "o2", "hi"))
+}
+
+func TestRateLimitOverride(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org1, "o3", "carol")
+	s.messenger(t, org2, "o2", "bob")
+	s.admin(org1)
+	checkOK(t, s.invoke("set_rate_limit", "o3", "1", "60"))
+
+	checkOK(t, s.send(org1, "m1", "o3", "o2", "hi"))
+	checkError(t, s.send(org1, "m2", "o3", "o2", "hi"), RATE_LIMITED, "used up its sends")
+	for i := 3; i <= 12; i++ {
+		checkOK(t, s.send(org1, "m"+strconv.Itoa(i), "o1", "o2", "hi"))
+	}
+}
+
+// ============================================================================================================================
+// Profiles - a messenger belongs to the org that created it, only that org acts for it
+// ============================================================================================================================
+func TestMessengerBelongsToCallerOrg(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+
+	var messenger Messenger
+	json.Unmarshal(s.MockStub.State["o1"], &messenger)
+	if messenger.Company != org1 {
+		t.Fatalf("expected company %s, got %s", org1, messenger.Company)
+	}
+
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("update_messenger", "o1", "display_name", "Alice A."))
+	s.as(org2, "mallory")
+	checkError(t, s.invoke("update_messenger", "o1", "display_name", "Mallory"), 500, "cannot act for messenger")
+	checkError(t, s.invoke("update_messenger", "o1", "nickname", "Al"), 500, "cannot act for messenger")
+}
+
+func TestOrgAdminDeletesMembersMessages(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org1, "o3", "carol")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "hi"))
+
+	s.as(org1, "carol")
+	checkError(t, s.invoke("delete_message", "m1", "o3"), 500, "cannot authorize deletion")
+	s.as(org2, "bob", "messaging.org_admin", "true")
+	checkError(t, s.invoke("delete_message", "m1", "o2"), 500, "cannot authorize deletion")
+
+	s.as(org1, "carol", "messaging.org_admin", "true")
+	checkOK(t, s.invoke("delete_message", "m1", "o3"))
+	if s.MockStub.State["m1"] != nil {
+		t.Fatalf("message not deleted")
+	}
+}
+
+// ============================================================================================================================
+// Events - send, read, ack and delete set an event named for who it is for, the payload never has the text
+// ============================================================================================================================
+func TestMessageEvents(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "top secret"))
+	s.as(org2, "bob")
+	checkOK(t, s.invoke("mark_read", "m1", "o2"))
+	checkOK(t, s.invoke("ack_message", "m1", "o2"))
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("delete_message", "m1", "o1"))
+
+	names := []string{}
+	for _, event := range s.events {
+		names = append(names, event.EventName)
+		if strings.Contains(string(event.Payload), "top secret") {
+			t.Fatalf("event %s carries the text", event.EventName)
+		}
+	}
+	checkIds(t, names, "message.sent.o2", "message.read.o1", "message.ack.o1", "message.delete.o2")
+
+	var event MessageEvent
+	json.Unmarshal(s.events[0].Payload, &event)
+	if event.MessageId != "m1" || event.Sender.Id != "o1" || event.Priority != 1 || event.Timestamp != s.now {
+		t.Fatalf("unexpected payload %s", s.events[0].Payload)
+	}
+}
+
+func TestRefusedAckSetsNoEvent(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	s.messenger(t, org3, "o3", "carol")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "hi"))
+
+	s.as(org3, "carol")
+	checkError(t, s.invoke("ack_message", "m1", "o3"), 500, "is not the recipient")
+	if len(s.events) != 1 {
+		t.Fatalf("expected only the send event, got %d events", len(s.events))
+	}
+}
+
+// ============================================================================================================================
+// Cancel Scheduled Message - only the sender, and only before it is delivered
+// ============================================================================================================================
+func TestCancelScheduledMessage(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	deliver_at := strconv.FormatInt(s.now+3600, 10)
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "maintenance tonight", "0", deliver_at))
+	checkOK(t, s.send(org1, "m2", "o1", "o2", "maintenance tomorrow", "0", deliver_at))
+
+	s.as(org2, "bob")
+	checkError(t, s.invoke("cancel_scheduled_message", "m1", "o2"), 500, "is not the sender")
+
+	s.as(org1, "alice")
+	checkOK(t, s.invoke("cancel_scheduled_message", "m1", "o1"))
+	if s.MockStub.State["m1"] != nil {
+		t.Fatalf("cancelled message still on the ledger")
+	}
+	checkIds(t, messageIds(t, s.invoke("getScheduledMessages", "o1")), "m2")
+
+	s.now += 3601
+	checkError(t, s.invoke("cancel_scheduled_message", "m2", "o1"), 500, "already delivered")
+}
+
+// ============================================================================================================================
+// Moderation - recipients report, admins hide or dismiss, each step is its own moderation action
+// ============================================================================================================================
+func TestReportAndHideMessage(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "buy cheap marbles"))
+	checkOK(t, s.send(org1, "m2", "o1", "o2", "lunch?"))
+
+	s.as(org2, "bob")
+	res := s.invoke("report_message", "m1", "o2", "spam")
+	checkOK(t, res)
+	report_id := string(res.Payload)
+
+	s.admin(org3)
+	res = s.invoke("getModerationQueue")
+	checkOK(t, res)
+	var queue []Report
+	json.Unmarshal(res.Payload, &queue)
+	if len(queue) != 1 || queue[0].Id != report_id || queue[0].MessageId != "m1" {
+		t.Fatalf("unexpected queue %s", res.Payload)
+	}
+	checkOK(t, s.invoke("hide_message", report_id, "spam"))
+	checkError(t, s.invoke("dismiss_report", report_id, "changed my mind"), 500, "already resolved")
+
+	if !s.message(t, "m1").Hidden {
+		t.Fatalf("message is not hidden")
+	}
+	s.as(org2, "bob")
+	checkIds(t, messageIds(t, s.invoke("getInboxByPriority", "o2")), "m2")
+	checkError(t, s.invoke("read_message", "m1"), 500, "Message does not exist")
+
+	actions := 0
+	for key, value := range s.MockStub.State {
+		if strings.HasPrefix(key, "\x00moderation_action\x00m1\x00") {
+			var moderation ModerationAction
+			json.Unmarshal(value, &moderation)
+			if moderation.ReportId != report_id {
+				t.Fatalf("unexpected moderation action %s", value)
+			}
+			actions++
+		}
+	}
+	if actions != 2 {
+		t.Fatalf("expected a report and a hide action, got %d", actions)
+	}
+}
+
+func TestModerationRefusals(t *testing.T) {
+	s := newTestStub()
+	s.messenger(t, org1, "o1", "alice")
+	s.messenger(t, org2, "o2", "bob")
+	s.messenger(t, org3, "o3", "carol")
+	checkOK(t, s.send(org1, "m1", "o1", "o2", "hi"))
+
+	s.as(org3, "carol")
+	checkError(t, s.invoke("report_message", "m1", "o3", "spam"), 500, "is not the recipient")
+
+	s.as(org2, "bob")
+	res := s.invoke("report_message", "m1", "o2", "spam")
+	checkOK(t, res)
+	checkError(t, s.invoke("hide_message", string(res.Payload), "spam"), 500, "not a messaging admin")
+	checkError(t, s.invoke("getModerationQueue"), 500, "not a messaging admin")
+
+	s.admin(org3)
+	checkOK(t, s.invoke("dismiss_report", string(res.Payload), "not spam"))
+	if s.message(t, "m1").Hidden {
+		t.Fatalf("dismissing hid the message")
+	}
+}
+
+// ============================================================================================================================
+// Conversation ids - ":" separates the parties of a conversation id, so messenger and group ids can't have it
+// ============================================================================================================================
+func TestConversationPartyIdsRefuseColon(t *testing.T) {
+	s := newTestStub()
+	s.as(org1, "alice")
+	checkError(t, s.invoke("init_messenger", "o1:o2", "alice"), 500, "cannot contain")
+	s.messenger(t, org1, "o1", "alice")
+	s.as(org1, "alice")
+	checkError(t, s.invoke("init_group", "g1:o1", "team", "o1"), 500, "cannot contain")
+	checkOK(t, s.invoke("init_group", "g1", "team", "o1"))
+}